@@ -122,6 +122,7 @@ func main() {
 	// Spin up agent.
 	c := agent.Config{
 		NodeConfig: nodeConfig,
+		Version:    gitVersion,
 	}
 	a, err := agent.New(c)
 	if err != nil {
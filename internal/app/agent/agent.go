@@ -3,17 +3,23 @@
 package agent
 
 import (
+	"net/http"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/sirupsen/logrus"
 	"github.com/sylabs/fuzzball-agent/internal/pkg/cache"
+	"github.com/sylabs/fuzzball-agent/internal/pkg/joblog"
+	"github.com/sylabs/fuzzball-agent/internal/pkg/queue"
 	vol "github.com/sylabs/fuzzball-agent/internal/pkg/volume"
 )
 
 // Config describes agent configuration.
 type Config struct {
 	NodeConfig *NodeConfig
+	Version    string
 }
 
 // Agent contains the state of the agent.
@@ -23,18 +29,63 @@ type Agent struct {
 	vm *vol.Manager
 	c  *cache.Cache
 	id string
+
+	version           string
+	heartbeatInterval time.Duration
+	stop              chan struct{}
+
+	jobs            *jobRegistry
+	q               *queue.Queue
+	logs            *joblog.Store
+	killGracePeriod time.Duration
+	maxJobTimeout   time.Duration
+
+	library    LibraryConfig
+	httpClient *http.Client
+	signatures SignaturePolicy
+	prepull    PrepullConfig
 }
 
 // New returns a new Agent.
 func New(c Config) (a Agent, err error) {
 	a = Agent{
-		id: "1", // TODO
+		version:           c.Version,
+		heartbeatInterval: c.NodeConfig.HeartbeatInterval(),
+		stop:              make(chan struct{}),
+		jobs:              newJobRegistry(),
+		q:                 queue.New(c.NodeConfig.JobLimits()),
+		killGracePeriod:   c.NodeConfig.KillGracePeriod(),
+		maxJobTimeout:     c.NodeConfig.MaxJobTimeout(),
+		library:           c.NodeConfig.LibraryConfig(),
+		httpClient:        newHTTPClient(),
+		signatures:        c.NodeConfig.SignaturePolicy(),
+		prepull:           c.NodeConfig.PrepullConfig(),
+	}
+
+	if err := a.signatures.validate(); err != nil {
+		return Agent{}, err
+	}
+
+	// Use the configured node ID, or fall back to a persisted one.
+	if a.id = c.NodeConfig.NodeID(); a.id != "" {
+		if err := validateID(a.id); err != nil {
+			return Agent{}, err
+		}
+	} else if a.id, err = loadOrCreateID(c.NodeConfig.StateDir()); err != nil {
+		return Agent{}, err
 	}
+	logrus.WithField("nodeID", a.id).Info("using node ID")
 
-	if a.vm, err = vol.NewManager(c.NodeConfig.VolumeConfig()); err != nil {
+	statePath := filepath.Join(c.NodeConfig.StateDir(), "volumes")
+	if a.vm, err = vol.NewManager(c.NodeConfig.VolumeConfig(), statePath); err != nil {
 		return Agent{}, err
 	}
 
+	if a.logs, err = joblog.New(c.NodeConfig.JobLogConfig()); err != nil {
+		return Agent{}, err
+	}
+	a.pruneJobLogs()
+
 	if a.nc, a.ec, err = connect(c); err != nil {
 		return Agent{}, err
 	}
@@ -56,7 +107,8 @@ func (a Agent) Run() error {
 	a.nc.SetClosedHandler(func(c *nats.Conn) {
 		logrus.WithFields(connectionFields(c)).Print("messaging system connection closed")
 
-		// Clean up volumes after connection has been closed.
+		// Clean up volumes that are not retained across restarts after connection has been
+		// closed. Other volumes are restored when the agent restarts.
 		a.vm.Purge()
 
 		wg.Done()
@@ -68,6 +120,17 @@ func (a Agent) Run() error {
 		return err
 	}
 
+	// Announce the node, and periodically let the service know it is alive.
+	if err := a.register(); err != nil {
+		logrus.WithError(err).Warn("failed to register node")
+		return err
+	}
+	go sendHeartbeats(a.ec, a.id, a.heartbeatInterval, a.stop)
+
+	// Warm the cache in the background, so that initial jobs do not wait for images.
+	// Results are published as for an image download request.
+	go a.prepullImages(a.stop, a.publishDownloadResult)
+
 	// Wait for messaging connection to close.
 	wg.Wait()
 
@@ -76,6 +139,14 @@ func (a Agent) Run() error {
 
 // Stop is used to gracefully stop the Agent.
 func (a Agent) Stop() {
+	close(a.stop)
+
+	// Cancel jobs and wait for them to report their final status, before the connection is
+	// drained and the volumes they use are purged.
+	a.jobs.cancelAll()
+	a.jobs.wait()
+	a.deregister()
+
 	if err := a.nc.Drain(); err == nats.ErrConnectionReconnecting {
 		logrus.Info("forcefully closing messaging system connection")
 		a.nc.Close()
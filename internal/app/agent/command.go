@@ -13,14 +13,23 @@ import (
 )
 
 // runCommand runs the command specified by name, with arguments args, with stdin, stdout and
-// stderr connected as one would expect.
-func runCommand(ctx context.Context, path string, args, env []string, dir string, stdin io.Reader, stdout, stderr io.Writer) (*os.ProcessState, error) {
-	cmd := exec.CommandContext(ctx, path, args...)
+// stderr connected as one would expect. If started is not nil, it is called with the process ID
+// once the process has started.
+//
+// If ctx is done before the command completes, SIGTERM is sent to the process group of the
+// command. If the command has not exited after the grace period, SIGKILL is sent.
+func runCommand(ctx context.Context, path string, args, env []string, dir string, stdin io.Reader, stdout, stderr io.Writer, grace time.Duration, started func(pid int)) (*os.ProcessState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path, args...)
 	cmd.Env = env
 	cmd.Dir = dir
 	cmd.Stdin = stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
+	setProcessGroup(cmd)
 
 	// Start the process.
 	startTime := time.Now()
@@ -37,6 +46,9 @@ func runCommand(ctx context.Context, path string, args, env []string, dir string
 		"pid":  cmd.Process.Pid,
 	})
 	log.Print("command started")
+	if started != nil {
+		started(cmd.Process.Pid)
+	}
 	defer func(t time.Time, cmd *exec.Cmd) {
 		log.WithFields(logrus.Fields{
 			"wallTime":   time.Since(t),
@@ -46,6 +58,31 @@ func runCommand(ctx context.Context, path string, args, env []string, dir string
 		}).Print("command finished")
 	}(startTime, cmd)
 
+	// Signal the process group if the context is done before the process exits.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+
+		log.WithField("gracePeriod", grace).Print("terminating command")
+		if err := terminateProcessGroup(cmd); err != nil {
+			log.WithError(err).Warn("failed to terminate command")
+		}
+
+		select {
+		case <-done:
+		case <-time.After(grace):
+			log.Print("killing command")
+			if err := killProcessGroup(cmd); err != nil {
+				log.WithError(err).Warn("failed to kill command")
+			}
+		}
+	}()
+
 	// Wait for process to finish.
 	err := cmd.Wait()
 	return cmd.ProcessState, err
@@ -0,0 +1,29 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+// +build !linux,!darwin
+
+package agent
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on this platform.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminateProcessGroup kills the process started by cmd, since graceful termination is not
+// supported on this platform.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// killProcessGroup kills the process started by cmd.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// exitSignal returns an empty string, since signals are not supported on this platform.
+func exitSignal(ps *os.ProcessState) string {
+	return ""
+}
@@ -63,7 +63,7 @@ func TestRunCommand(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			stdout := &bytes.Buffer{}
 			stderr := &bytes.Buffer{}
-			_, err := runCommand(tt.args.ctx, tt.args.path, tt.args.args, tt.args.env, tt.args.dir, tt.args.stdin, stdout, stderr)
+			_, err := runCommand(tt.args.ctx, tt.args.path, tt.args.args, tt.args.env, tt.args.dir, tt.args.stdin, stdout, stderr, time.Second, nil)
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
 			}
@@ -76,3 +76,33 @@ func TestRunCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestRunCommandCancel(t *testing.T) {
+	shPath, err := exec.LookPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"Terminate", "sleep 60"},
+		{"KillAfterGracePeriod", "trap '' TERM; sleep 60"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			_, err := runCommand(ctx, shPath, []string{"-c", tt.script}, nil, "", nil, &bytes.Buffer{}, &bytes.Buffer{}, 100*time.Millisecond, nil)
+			if err == nil {
+				t.Fatalf("got nil error, want error")
+			}
+			if took := time.Since(start); took > 10*time.Second {
+				t.Errorf("command took %v to stop", took)
+			}
+		})
+	}
+}
@@ -4,16 +4,35 @@ package agent
 
 import (
 	"io"
+	"path/filepath"
+	"time"
 
 	"github.com/sylabs/fuzzball-agent/internal/pkg/cache"
+	"github.com/sylabs/fuzzball-agent/internal/pkg/joblog"
+	"github.com/sylabs/fuzzball-agent/internal/pkg/queue"
 	vol "github.com/sylabs/fuzzball-agent/internal/pkg/volume"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	defaultHeartbeatInterval = 30 * time.Second
+	defaultKillGracePeriod   = 10 * time.Second
+)
+
 type rawConfig struct {
-	NATSServers   []string     `yaml:"natsServers"`   // Array of nats server endpopints.
-	VolumeSupport vol.Config   `yaml:"volumeSupport"` // List of available volume types.
-	CacheConfig   cache.Config `yaml:"cacheConfig"`   // Description of fs location to store temporary data.
+	NodeID            string          `yaml:"nodeID"`            // Identity of the node (generated if not set).
+	StateDir          string          `yaml:"stateDir"`          // Directory in which to persist agent state.
+	NATSServers       []string        `yaml:"natsServers"`       // Array of nats server endpopints.
+	HeartbeatInterval time.Duration   `yaml:"heartbeatInterval"` // Interval between node heartbeats.
+	KillGracePeriod   time.Duration   `yaml:"killGracePeriod"`   // Time between SIGTERM and SIGKILL when stopping a job.
+	MaxJobTimeout     time.Duration   `yaml:"maxJobTimeout"`     // Maximum wall-clock run time of a job.
+	JobLimits         queue.Config    `yaml:"jobLimits"`         // Limits on concurrently running jobs.
+	JobLogs           joblog.Config   `yaml:"jobLogs"`           // Description of local job output logs.
+	VolumeSupport     vol.Config      `yaml:"volumeSupport"`     // List of available volume types.
+	CacheConfig       cache.Config    `yaml:"cacheConfig"`       // Description of fs location to store temporary data.
+	Library           LibraryConfig   `yaml:"library"`           // Description of Sylabs libraries used to pull images.
+	Signatures        SignaturePolicy `yaml:"signatures"`        // Signature verification applied to images.
+	Prepull           PrepullConfig   `yaml:"prepull"`           // Images to download to the cache at startup.
 }
 
 // NodeConfig represents a configuration.
@@ -30,6 +49,27 @@ func Read(r io.Reader) (*NodeConfig, error) {
 	return &c, nil
 }
 
+func (nc *NodeConfig) SetNodeID(id string) {
+	nc.raw.NodeID = id
+}
+
+func (nc NodeConfig) NodeID() string {
+	return nc.raw.NodeID
+}
+
+func (nc *NodeConfig) SetStateDir(dir string) {
+	nc.raw.StateDir = dir
+}
+
+// StateDir returns the directory in which agent state is persisted. If not configured, a
+// directory within the cache directory is used.
+func (nc NodeConfig) StateDir() string {
+	if nc.raw.StateDir != "" {
+		return nc.raw.StateDir
+	}
+	return filepath.Join(nc.raw.CacheConfig.CacheDir, "fuzzball", "state")
+}
+
 func (nc *NodeConfig) SetNATSServers(uris []string) {
 	nc.raw.NATSServers = uris
 }
@@ -38,6 +78,61 @@ func (nc NodeConfig) NATSServers() []string {
 	return nc.raw.NATSServers
 }
 
+func (nc *NodeConfig) SetHeartbeatInterval(d time.Duration) {
+	nc.raw.HeartbeatInterval = d
+}
+
+// HeartbeatInterval returns the interval between node heartbeats.
+func (nc NodeConfig) HeartbeatInterval() time.Duration {
+	if nc.raw.HeartbeatInterval > 0 {
+		return nc.raw.HeartbeatInterval
+	}
+	return defaultHeartbeatInterval
+}
+
+func (nc *NodeConfig) SetKillGracePeriod(d time.Duration) {
+	nc.raw.KillGracePeriod = d
+}
+
+// KillGracePeriod returns the time to wait after sending SIGTERM to a job before sending SIGKILL.
+func (nc NodeConfig) KillGracePeriod() time.Duration {
+	if nc.raw.KillGracePeriod > 0 {
+		return nc.raw.KillGracePeriod
+	}
+	return defaultKillGracePeriod
+}
+
+func (nc *NodeConfig) SetMaxJobTimeout(d time.Duration) {
+	nc.raw.MaxJobTimeout = d
+}
+
+// MaxJobTimeout returns the maximum wall-clock run time of a job. A zero value indicates no limit.
+func (nc NodeConfig) MaxJobTimeout() time.Duration {
+	return nc.raw.MaxJobTimeout
+}
+
+func (nc *NodeConfig) SetJobLimits(qc queue.Config) {
+	nc.raw.JobLimits = qc
+}
+
+func (nc NodeConfig) JobLimits() queue.Config {
+	return nc.raw.JobLimits
+}
+
+func (nc *NodeConfig) SetJobLogConfig(jc joblog.Config) {
+	nc.raw.JobLogs = jc
+}
+
+// JobLogConfig returns the job log configuration. If no directory is configured, a directory
+// within the state directory is used.
+func (nc NodeConfig) JobLogConfig() joblog.Config {
+	jc := nc.raw.JobLogs
+	if jc.Dir == "" {
+		jc.Dir = filepath.Join(nc.StateDir(), "logs")
+	}
+	return jc
+}
+
 func (nc *NodeConfig) SetVolumeConfig(vc vol.Config) {
 	nc.raw.VolumeSupport = vc
 }
@@ -53,3 +148,27 @@ func (nc *NodeConfig) SetCacheConfig(cc cache.Config) {
 func (nc NodeConfig) CacheConfig() cache.Config {
 	return nc.raw.CacheConfig
 }
+
+func (nc *NodeConfig) SetLibraryConfig(lc LibraryConfig) {
+	nc.raw.Library = lc
+}
+
+func (nc NodeConfig) LibraryConfig() LibraryConfig {
+	return nc.raw.Library
+}
+
+func (nc *NodeConfig) SetSignaturePolicy(sp SignaturePolicy) {
+	nc.raw.Signatures = sp
+}
+
+func (nc NodeConfig) SignaturePolicy() SignaturePolicy {
+	return nc.raw.Signatures
+}
+
+func (nc *NodeConfig) SetPrepullConfig(pc PrepullConfig) {
+	nc.raw.Prepull = pc
+}
+
+func (nc NodeConfig) PrepullConfig() PrepullConfig {
+	return nc.raw.Prepull
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+	"github.com/sylabs/fuzzball-agent/internal/pkg/cache"
+)
+
+// cacheEvictRequest describes the cache entries to evict. Entries matching either criteria are
+// evicted.
+type cacheEvictRequest struct {
+	Hash      string        // Evict entries with this hash.
+	OlderThan time.Duration // Evict entries not used within this duration.
+}
+
+func (a *Agent) cacheListHandler(m *nats.Msg) {
+	log := logrus.WithFields(logrus.Fields{
+		"subject": m.Subject,
+		"reply":   m.Reply,
+	})
+	log.Print("handling cache list")
+	defer func(t time.Time) {
+		log.WithField("took", time.Since(t)).Print("handled cache list")
+	}(time.Now())
+
+	// Send result.
+	res := struct {
+		Entries []cache.EntryInfo
+	}{a.c.List()}
+	if err := a.ec.Publish(m.Reply, res); err != nil {
+		log.WithError(err).Warn("failed to report cache list")
+	}
+}
+
+func (a *Agent) cacheStatsHandler(m *nats.Msg) {
+	log := logrus.WithFields(logrus.Fields{
+		"subject": m.Subject,
+		"reply":   m.Reply,
+	})
+	log.Print("handling cache stats")
+	defer func(t time.Time) {
+		log.WithField("took", time.Since(t)).Print("handled cache stats")
+	}(time.Now())
+
+	// Send result.
+	if err := a.ec.Publish(m.Reply, a.c.Stats()); err != nil {
+		log.WithError(err).Warn("failed to report cache stats")
+	}
+}
+
+func (a *Agent) cacheEvictHandler(subject, reply string, r cacheEvictRequest) {
+	log := logrus.WithFields(logrus.Fields{
+		"subject":   subject,
+		"reply":     reply,
+		"hash":      r.Hash,
+		"olderThan": r.OlderThan,
+	})
+	log.Print("handling cache evict")
+	defer func(t time.Time) {
+		log.WithField("took", time.Since(t)).Print("handled cache evict")
+	}(time.Now())
+
+	var res struct {
+		Evicted []cache.EntryInfo
+		Err     string `json:",omitempty"`
+	}
+
+	if r.Hash == "" && r.OlderThan <= 0 {
+		res.Err = "one of hash or age must be specified"
+	} else {
+		cutoff := time.Now().Add(-r.OlderThan)
+		res.Evicted = a.c.Evict(func(e cache.EntryInfo) bool {
+			return e.Hash == r.Hash || (r.OlderThan > 0 && e.LastUsed.Before(cutoff))
+		})
+	}
+
+	// Send result.
+	if err := a.ec.Publish(reply, res); err != nil {
+		log.WithError(err).Warn("failed to report cache evict")
+	}
+}
@@ -5,17 +5,81 @@ package agent
 import (
 	"context"
 	"fmt"
-	"os"
-	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/sylabs/fuzzball-agent/internal/pkg/cache"
-	scs "github.com/sylabs/scs-library-client/client"
 )
 
+// downloadProgressInterval is the interval between image download progress events.
+const downloadProgressInterval = time.Second
+
 type image struct {
-	URI string
+	URI  string
+	Hash string // Hash of the image, required for sources that do not include one in the URI.
+}
+
+// downloadProgress counts bytes written during an image download.
+type downloadProgress struct {
+	n     int64 // Bytes downloaded so far (accessed atomically).
+	total int64 // Total bytes expected, or -1 if unknown (accessed atomically).
+}
+
+func (p *downloadProgress) Write(b []byte) (int, error) {
+	atomic.AddInt64(&p.n, int64(len(b)))
+	return len(b), nil
+}
+
+func (p *downloadProgress) bytes() int64 {
+	return atomic.LoadInt64(&p.n)
+}
+
+// subjectTokenReplacer replaces characters that are not permitted within a subject token.
+var subjectTokenReplacer = strings.NewReplacer(".", "-", ":", "-", "*", "-", ">", "-", " ", "-")
+
+// subjectToken returns a form of hash that can be used as a single subject token, such that
+// "sha256.<hex>" becomes "sha256-<hex>". Messages published to such subjects carry the original
+// hash in their payload.
+func subjectToken(hash string) string {
+	return subjectTokenReplacer.Replace(hash)
+}
+
+// imageProgress is published periodically during an image download.
+type imageProgress struct {
+	Hash  string
+	Bytes int64 // Bytes downloaded so far.
+	Total int64 // Total bytes expected, or -1 if unknown.
+}
+
+// imageDownloadResult is published when an image download is complete.
+type imageDownloadResult struct {
+	Hash     string
+	Path     string        // Location of the image in the cache.
+	Bytes    int64         // Bytes downloaded.
+	Duration time.Duration // Time taken to download.
+	Err      string        `json:",omitempty"`
+}
+
+// reportDownloadProgress publishes the progress of the download of the image with the supplied
+// hash every interval, until stop is closed.
+func (a *Agent) reportDownloadProgress(hash string, p *downloadProgress, interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	subject := fmt.Sprintf("image.%v.progress", subjectToken(hash))
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			res := imageProgress{hash, p.bytes(), atomic.LoadInt64(&p.total)}
+			if err := a.ec.Publish(subject, res); err != nil {
+				logrus.WithError(err).WithField("subject", subject).Warn("failed to report image download progress")
+			}
+		}
+	}
 }
 
 func (a *Agent) imageDownloadHandler(subject, reply string, i image) {
@@ -34,66 +98,93 @@ func (a *Agent) imageDownloadHandler(subject, reply string, i image) {
 		log.WithError(err).Warn("failed to acknowledge image download")
 	}
 
-	// Returned tag should be a unique identifier of the image
-	err := a.libraryImageDownload(i.URI)
+	// Download image, reporting results on a subject specific to the image hash, if it can be
+	// determined.
+	res, err := a.downloadImage(i.URI, i.Hash)
 	if err != nil {
-		log.WithError(err).Warnf("could not download library image: %v", err)
-	}
-
-	// Send result.
-	res := struct {
-		Err error
-	}{err}
-	if err := a.ec.Publish("image.download", res); err != nil {
-		log.WithError(err).Warn("failed to report image download")
+		log.WithError(err).Warn("could not download image")
 	}
+	a.publishDownloadResult(res, log)
 }
 
-func (a *Agent) libraryImageDownload(uri string) error {
-	// Parse image uri
-	r, err := scs.Parse(uri)
-	if err != nil {
-		return err
+// publishDownloadResult publishes res to a subject specific to the image hash, if it could be
+// determined, or to image.download otherwise.
+func (a *Agent) publishDownloadResult(res imageDownloadResult, log *logrus.Entry) {
+	subject := "image.download"
+	if res.Hash != "" {
+		subject = fmt.Sprintf("image.%v.download", subjectToken(res.Hash))
 	}
 
-	var tag string
-	if len(r.Tags) > 0 {
-		tag = r.Tags[0]
+	if err := a.ec.Publish(subject, res); err != nil {
+		log.WithError(err).Warn("failed to report image download")
 	}
+}
 
-	// Ensure tag guarantees for reproducable image pulls
-	if !scs.IsImageHash(tag) {
-		return fmt.Errorf("tag must be the image hash, received %v", tag)
+// downloadImage downloads the image at uri with the supplied hash (which may be empty, if the
+// hash is included in uri) to the cache, publishing progress periodically. If the image is
+// already present in the cache, it is not downloaded again.
+// Concurrent downloads of the same image are deduplicated, with all callers receiving the same
+// result. If signature verification is required, images that fail verification are discarded.
+func (a *Agent) downloadImage(uri, hash string) (imageDownloadResult, error) {
+	src, err := a.parseImageSource(uri, hash)
+	if err != nil {
+		// Report against the requested hash, if any, where the requester expects the result.
+		return imageDownloadResult{Hash: hash, Err: err.Error()}, err
 	}
+	hash = src.hash()
 
-	// Point library client to specific library if included in uri
-	var scsConf *scs.Config
-	if r.Host != "" {
-		scsConf = &scs.Config{BaseURL: "https://" + r.Host}
-	}
+	v, shared, err := a.c.Do(src.cacheType(), hash, func() (interface{}, error) {
+		// Nothing to do if the image is already present.
+		if entry, ok := a.c.Lookup(src.cacheType(), hash); ok {
+			return imageDownloadResult{Hash: hash, Path: entry.Path()}, nil
+		}
 
-	// Initialize library client
-	client, err := scs.NewClient(scsConf)
-	if err != nil {
-		return err
-	}
+		// Report progress periodically until download is complete.
+		p := &downloadProgress{total: -1}
+		stop := make(chan struct{})
+		go a.reportDownloadProgress(hash, p, downloadProgressInterval, stop)
 
-	// Get cache entry for image to be downloaded
-	entry := a.c.GetEntry(cache.SIFType, tag)
+		// Pull image to a temporary file, which is moved into place once the image has been
+		// verified.
+		start := time.Now()
+		entry, _ := a.c.Lookup(src.cacheType(), hash)
+		err := entry.Fill(func(path string) error {
+			if err := src.pull(context.Background(), path, p); err != nil {
+				return err
+			}
+			_, err := a.verifyImage(context.Background(), path)
+			return err
+		})
+		close(stop)
 
-	// Open file descriptor to download image to cache entry
-	f, err := os.Create(entry.Path())
-	if err != nil {
-		return err
+		res := imageDownloadResult{
+			Hash:     hash,
+			Bytes:    p.bytes(),
+			Duration: time.Since(start),
+		}
+		if err != nil {
+			res.Err = err.Error()
+		} else {
+			res.Path = entry.Path()
+		}
+		return res, err
+	})
+	if shared {
+		logrus.WithField("hash", hash).Print("shared result of concurrent image download")
 	}
-	defer f.Close()
+	return v.(imageDownloadResult), err
+}
 
-	// Download image from library.
-	err = client.DownloadImage(context.Background(), f, runtime.GOARCH, r.Path, tag, nil)
-	if err != nil {
-		return err
+// lookupImage returns the cache entry for the image with the supplied hash, and whether it is
+// present in the cache. All types of cache entry are searched. As lookups are queries rather
+// than use of the image, they do not affect cache statistics or eviction order.
+func (a *Agent) lookupImage(hash string) (*cache.Entry, bool) {
+	for _, t := range a.c.Types() {
+		if entry, ok := a.c.Lookup(t, hash); ok {
+			return entry, true
+		}
 	}
-	return nil
+	return nil, false
 }
 
 func (a *Agent) imageCachedHandler(subject, reply string, hash string) {
@@ -113,14 +204,53 @@ func (a *Agent) imageCachedHandler(subject, reply string, hash string) {
 	}
 
 	// Get cache entry for image to be downloaded
-	entry := a.c.GetEntry(cache.SIFType, hash)
+	_, exists := a.lookupImage(hash)
 
-	log.Infof("entry exists: %v", entry.Exists())
+	log.Infof("entry exists: %v", exists)
 	// Send result.
 	res := struct {
 		Exists bool
-	}{entry.Exists()}
+	}{exists}
 	if err := a.ec.Publish("image.cached", res); err != nil {
 		log.WithError(err).Warn("failed to report image cache check")
 	}
 }
+
+// imageCachedStatus describes the presence of an image in the cache.
+type imageCachedStatus struct {
+	Present bool
+	Size    int64 `json:",omitempty"`
+}
+
+// imageCachedStatuses returns the status of each of the images with the supplied hashes, of any
+// cache type.
+func (a *Agent) imageCachedStatuses(hashes []string) map[string]imageCachedStatus {
+	res := make(map[string]imageCachedStatus, len(hashes))
+	for _, hash := range hashes {
+		var s imageCachedStatus
+		if entry, ok := a.lookupImage(hash); ok {
+			if size, err := entry.Size(); err == nil {
+				s = imageCachedStatus{true, size}
+			}
+		}
+		res[hash] = s
+	}
+	return res
+}
+
+func (a *Agent) imageCachedBatchHandler(subject, reply string, hashes []string) {
+	log := logrus.WithFields(logrus.Fields{
+		"subject": subject,
+		"reply":   reply,
+		"hashes":  len(hashes),
+	})
+	log.Print("handling batch image cache check")
+	defer func(t time.Time) {
+		log.WithField("took", time.Since(t)).Print("handled batch image cache check")
+	}(time.Now())
+
+	// Send result.
+	if err := a.ec.Publish(reply, a.imageCachedStatuses(hashes)); err != nil {
+		log.WithError(err).Warn("failed to report batch image cache check")
+	}
+}
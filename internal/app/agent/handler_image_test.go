@@ -0,0 +1,88 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/sylabs/fuzzball-agent/internal/pkg/cache"
+)
+
+func TestDownloadImageInvalidURI(t *testing.T) {
+	const hash = "sha256.8d9bb8b4b0b4cfb4dd1bb5d5ae1bd6e7d3c1f2d0c62c5e0ac76cfbc0d8eaa5f1"
+
+	a := Agent{}
+	res, err := a.downloadImage("shub://alpine", hash)
+	if err == nil {
+		t.Fatalf("got nil error")
+	}
+	if res.Hash != hash {
+		t.Errorf("got hash %v, want %v", res.Hash, hash)
+	}
+	if res.Err == "" {
+		t.Errorf("got empty error in result")
+	}
+}
+
+func TestSubjectToken(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+		want string
+	}{
+		{"SIF", "sha256.8d9bb8", "sha256-8d9bb8"},
+		{"Docker", "sha256:8d9bb8", "sha256-8d9bb8"},
+		{"Wildcards", "a*b>c", "a-b-c"},
+		{"Plain", "8d9bb8", "8d9bb8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subjectToken(tt.hash); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageCachedStatuses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-image-cached-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := cache.New(cache.Config{CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Populate the cache with images of different types.
+	images := map[string]int{cache.SIFType: 3, cache.DockerType: 5}
+	for cacheType, size := range images {
+		err := c.GetEntry(cacheType, cacheType+"-image").Fill(func(path string) error {
+			return ioutil.WriteFile(path, make([]byte, size), 0600)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := Agent{c: c}
+	got := a.imageCachedStatuses([]string{"sif-image", "docker-image", "missing"})
+
+	want := map[string]imageCachedStatus{
+		"sif-image":    {Present: true, Size: 3},
+		"docker-image": {Present: true, Size: 5},
+		"missing":      {},
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v statuses, want %v", len(got), len(want))
+	}
+	for hash, w := range want {
+		if g, ok := got[hash]; !ok || g != w {
+			t.Errorf("got status %+v for %v, want %+v", g, hash, w)
+		}
+	}
+}
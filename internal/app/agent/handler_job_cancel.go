@@ -0,0 +1,43 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+)
+
+// jobIDFromSubject returns the job ID from a subject of the form node.<id>.job.<jobID>.<op>.
+func jobIDFromSubject(subject string) string {
+	if tokens := strings.Split(subject, "."); len(tokens) == 5 {
+		return tokens[3]
+	}
+	return ""
+}
+
+func (a *Agent) jobCancelHandler(m *nats.Msg) {
+	jobID := jobIDFromSubject(m.Subject)
+
+	log := logrus.WithFields(logrus.Fields{
+		"subject": m.Subject,
+		"reply":   m.Reply,
+		"jobID":   jobID,
+	})
+	log.Print("handling job cancel")
+	defer func(t time.Time) {
+		log.WithField("took", time.Since(t)).Print("handled job cancel")
+	}(time.Now())
+
+	// Send acknowledgement.
+	if err := a.ec.Publish(m.Reply, nil); err != nil {
+		log.WithError(err).Warn("failed to acknowledge job cancel")
+	}
+
+	// Cancel job. The result is reported when the job finishes.
+	if err := a.jobs.cancel(jobID); err != nil {
+		log.WithError(err).Warn("failed to cancel job")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+)
+
+// logsRequest describes a request for stored job output.
+type logsRequest struct {
+	Stream string // Name of the stream ("stdout" or "stderr"). Defaults to "stdout".
+	Offset int64  // Offset within the stream from which to read.
+	Tail   int    // If non-zero, the number of lines to return from the end of the stream.
+	Limit  int    // Maximum number of bytes to return. Defaults to the maximum allowed.
+}
+
+// logsResponse contains stored job output.
+type logsResponse struct {
+	Data   []byte
+	Offset int64  // Offset of Data within the stream.
+	Err    string `json:",omitempty"`
+}
+
+// readLogs returns stored output for the specified job, as described by r.
+func (a *Agent) readLogs(jobID string, r logsRequest) (logsResponse, error) {
+	if r.Stream == "" {
+		r.Stream = streamStdout
+	}
+	if r.Stream != streamStdout && r.Stream != streamStderr {
+		return logsResponse{}, fmt.Errorf("unknown stream %q", r.Stream)
+	}
+
+	// Ensure response fits within a single message.
+	if max := maxDataSize(a.nc.MaxPayload()); r.Limit <= 0 || r.Limit > max {
+		r.Limit = max
+	}
+
+	var res logsResponse
+	var err error
+	if r.Tail > 0 {
+		res.Data, res.Offset, err = a.logs.Tail(jobID, r.Stream, r.Tail, r.Limit)
+	} else {
+		res.Data, res.Offset, err = a.logs.Read(jobID, r.Stream, r.Offset, r.Limit)
+	}
+	return res, err
+}
+
+func (a *Agent) jobLogsHandler(m *nats.Msg) {
+	jobID := jobIDFromSubject(m.Subject)
+
+	log := logrus.WithFields(logrus.Fields{
+		"subject": m.Subject,
+		"reply":   m.Reply,
+		"jobID":   jobID,
+	})
+	log.Print("handling job logs")
+	defer func(t time.Time) {
+		log.WithField("took", time.Since(t)).Print("handled job logs")
+	}(time.Now())
+
+	// An empty request reads from the start of stdout.
+	var r logsRequest
+	var err error
+	if len(m.Data) > 0 {
+		err = json.Unmarshal(m.Data, &r)
+	}
+
+	var res logsResponse
+	if err == nil {
+		res, err = a.readLogs(jobID, r)
+	}
+	if err != nil {
+		log.WithError(err).Warn("failed to read job logs")
+		res = logsResponse{Err: err.Error()}
+	}
+
+	// Send result.
+	if err := a.ec.Publish(m.Reply, res); err != nil {
+		log.WithError(err).Warn("failed to report job logs")
+	}
+}
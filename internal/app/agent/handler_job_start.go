@@ -5,12 +5,14 @@ package agent
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
-	"github.com/sylabs/fuzzball-agent/internal/pkg/cache"
+	"github.com/sylabs/fuzzball-agent/internal/pkg/queue"
 )
 
 type job struct {
@@ -21,11 +23,16 @@ type job struct {
 	Volumes []volumeRequirement
 	Cached  bool
 	Hash    string
+	Timeout time.Duration // Maximum wall-clock run time (zero indicates no limit).
+	CPUs    int           // Number of CPUs required.
+	Memory  uint64        // Bytes of memory required.
 }
 
 type volumeRequirement struct {
 	VolumeID string
 	Location string
+	ReadOnly bool     // Mount the volume read-only.
+	Options  []string // Additional Singularity bind options (rw, ro, image-src=<path> or id=<n>).
 }
 
 func (a *Agent) jobStartHandler(subject, reply string, j *job) {
@@ -44,42 +51,190 @@ func (a *Agent) jobStartHandler(subject, reply string, j *job) {
 		log.WithError(err).Warn("failed to acknowledge job start")
 	}
 
-	// Create stream for output.
-	s := stream{j.ID, a.nc}
+	// Register job, so that it can be canceled while queued or running.
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := a.jobs.add(j.ID, cancel); err != nil {
+		cancel()
+		log.WithError(err).Warn("failed to register job")
+		return
+	}
+	a.publishJobStatus(j.ID, jobStatus{Status: stateAccepted}, log)
+
+	// Execute job asynchronously, so that subsequent jobs can be queued.
+	go func() {
+		defer a.jobs.remove(j.ID)
+		defer cancel()
+		a.executeJob(ctx, *j, log)
+	}()
+}
+
+// executeJob waits for resources to become available, runs j, and reports the result.
+func (a *Agent) executeJob(ctx context.Context, j job, log *logrus.Entry) {
+	report := func(s jobStatus) {
+		a.publishJobStatus(j.ID, s, log)
+	}
+
+	// Wait for resources to become available, reporting position in the queue.
+	r := queue.Request{CPUs: j.CPUs, Memory: j.Memory}
+	release, err := a.q.Acquire(ctx, r, func(pos int) {
+		report(jobStatus{Status: stateQueued, Position: pos})
+	})
+	if err != nil {
+		log.WithError(err).Warn("failed to acquire job resources")
+		report(finishedStatus(ctx, nil, err))
+		return
+	}
+	defer release()
+
+	// Apply time limit, if any.
+	runCtx, cancel := context.WithCancel(ctx)
+	if timeout := a.jobTimeout(j); timeout > 0 {
+		log = log.WithField("timeout", timeout)
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	// Create streams for output, and tee them to local log files.
+	var closers []io.Closer
+	outputs := make(map[string]io.Writer)
+	for _, name := range []string{streamStdout, streamStderr} {
+		s := newStream(a.ec, a.nc.MaxPayload(), j.ID, name)
+		closers = append(closers, s)
+		outputs[name] = s
+
+		w, err := a.logs.Create(j.ID, name)
+		if err != nil {
+			log.WithError(err).WithField("stream", name).Warn("failed to create job log")
+			continue
+		}
+		closers = append(closers, w)
+		outputs[name] = io.MultiWriter(s, &logWriter{w: w, log: log.WithField("stream", name)})
+	}
 
 	// Run Job.
-	rc, err := a.runJob(context.TODO(), *j, s) // TODO: use context for cancellation?
+	start := time.Now()
+	ps, wallTime, err := a.runJob(runCtx, j, outputs[streamStdout], outputs[streamStderr], report)
+
+	// Flush output, mark end of streams, and close logs.
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			log.WithError(err).Warn("failed to close job output")
+		}
+	}
+
 	// Send result.
-	status := "COMPLETED"
+	res := finishedStatus(runCtx, ps, err)
+	res.Elapsed = time.Since(start)
+	res.WallTime = wallTime
+	report(res)
+
+	// Remove logs of older jobs, now that this one has finished.
+	a.pruneJobLogs()
+}
+
+// logWriter writes job output to a local log. Logging is best effort, so the first error is
+// logged and subsequent writes are discarded, rather than failing the job.
+type logWriter struct {
+	w      io.Writer
+	log    *logrus.Entry
+	failed bool
+}
+
+func (lw *logWriter) Write(b []byte) (int, error) {
+	if lw.failed {
+		return len(b), nil
+	}
+	if _, err := lw.w.Write(b); err != nil {
+		lw.log.WithError(err).Warn("failed to write job log, discarding further output")
+		lw.failed = true
+	}
+	return len(b), nil
+}
+
+// pruneJobLogs removes logs of finished jobs in excess of the configured retention limits.
+func (a *Agent) pruneJobLogs() {
+	pruned, err := a.logs.Prune(a.jobs.has)
 	if err != nil {
-		status = "FAILED"
+		logrus.WithError(err).Warn("failed to prune job logs")
 	}
-	res := struct {
-		Status string
-		RC     int
-	}{status, rc}
-	if err := a.ec.Publish(fmt.Sprintf("job.%v.finished", j.ID), res); err != nil {
-		log.WithError(err).Warn("failed to report job finished")
+	if len(pruned) > 0 {
+		logrus.WithField("jobs", len(pruned)).Info("pruned job logs")
 	}
 }
 
-// runJob runs the specified job, returning the process exitCode.
-func (a *Agent) runJob(ctx context.Context, j job, s stream) (int, error) {
+// jobTimeout returns the time limit for j, taking into account the maximum configured for the
+// node. A zero value indicates no limit.
+func (a *Agent) jobTimeout(j job) time.Duration {
+	switch {
+	case a.maxJobTimeout <= 0:
+		return j.Timeout
+	case j.Timeout <= 0 || j.Timeout > a.maxJobTimeout:
+		return a.maxJobTimeout
+	default:
+		return j.Timeout
+	}
+}
+
+// runJob runs the specified job, returning the process state and wall time. Output is written to
+// stdout and stderr, and transitions in the lifecycle of the job are reported via report.
+func (a *Agent) runJob(ctx context.Context, j job, stdout, stderr io.Writer, report func(jobStatus)) (*os.ProcessState, time.Duration, error) {
 	// Locate Singularity in PATH.
 	path, err := exec.LookPath("singularity")
 	if err != nil {
-		return 0, err
+		return nil, 0, err
+	}
+
+	image := j.Image
+	if !j.Cached && a.signatures.Required {
+		return nil, 0, verifyError{fmt.Errorf("image must be cached to be verified")}
+	}
+
+	var verified bool
+	if j.Cached {
+		src, err := a.parseImageSource(j.Image, j.Hash)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// Lookup image in cache, pulling it if it has not already been downloaded. The entry is
+		// marked as in use for the duration of the job, so that it is not evicted.
+		entry := a.c.GetEntry(src.cacheType(), src.hash())
+		release := entry.Acquire()
+		defer release()
+
+		if !entry.Exists() {
+			report(jobStatus{Status: statePullingImage})
+			if _, err := a.downloadImage(j.Image, j.Hash); err != nil {
+				return nil, 0, fmt.Errorf("failed to pull image: %w", err)
+			}
+		}
+		if !entry.Exists() {
+			return nil, 0, fmt.Errorf("expected cached image does not exist in cache")
+		}
+		image = entry.Path()
+
+		// Verify the image again, as the cached image or the keyring may have changed since it
+		// was downloaded.
+		if verified, err = a.verifyImage(ctx, image); err != nil {
+			return nil, 0, err
+		}
 	}
 
 	// Generate bind path args for volumes
+	if len(j.Volumes) > 0 {
+		report(jobStatus{Status: statePreparingVolumes})
+	}
 	var bindPaths []string
 	for _, v := range j.Volumes {
 		h, err := a.vm.GetHandle(v.VolumeID)
 		if err != nil {
-			return 0, err
+			return nil, 0, err
 		}
 
-		bp := h + ":" + v.Location
+		bp, err := bindPath(h, v)
+		if err != nil {
+			return nil, 0, err
+		}
 		bindPaths = append(bindPaths, bp)
 	}
 
@@ -88,31 +243,77 @@ func (a *Agent) runJob(ctx context.Context, j job, s stream) (int, error) {
 		"exec",
 	}
 
-	// Bind paths are a comma separated list.
-	if bindPaths != nil {
-		args = append(args, "--bind", strings.Join(bindPaths, ","))
-	}
-
-	image := j.Image
-	if j.Cached {
-		// Lookup image in cache and ensure it exists
-		entry := a.c.GetEntry(cache.SIFType, j.Hash)
-		if !entry.Exists() {
-			return 0, fmt.Errorf("expected cached image does not exist in cache")
-		}
-		image = entry.Path()
+	// Each volume is bound using a separate flag.
+	for _, bp := range bindPaths {
+		args = append(args, "--bind", bp)
 	}
 
 	args = append(args, image)
 	args = append(args, j.Command...)
 
-	// Run Singularity.
-	state, err := runCommand(ctx, path, args, []string{}, "", nil, s, s)
+	// Run Singularity, reporting when it has started.
+	var startTime time.Time
+	started := func(pid int) {
+		startTime = time.Now()
+		t := startTime.UTC()
+		report(jobStatus{Status: stateRunning, PID: pid, StartTime: &t, Verified: verified})
+	}
+	state, err := runCommand(ctx, path, args, []string{}, "", nil, stdout, stderr, a.killGracePeriod, started)
 	if err != nil {
-		if state != nil {
-			return state.ExitCode(), err
+		err = a.checkVolumeLimits(j, err)
+	}
+	if startTime.IsZero() {
+		return state, 0, err
+	}
+	return state, time.Since(startTime), err
+}
+
+// checkVolumeLimits adds detail to err, which caused j to fail, if any volume used by j has
+// reached its size limit.
+func (a *Agent) checkVolumeLimits(j job, err error) error {
+	for _, v := range j.Volumes {
+		if a.vm.Full(v.VolumeID) {
+			return fmt.Errorf("%w: volume %v reached its size limit", err, v.VolumeID)
 		}
-		return 0, err
 	}
-	return state.ExitCode(), nil
+	return err
+}
+
+// bindPath returns the Singularity bind path that mounts the volume with handle h as described
+// by v.
+func bindPath(h string, v volumeRequirement) (string, error) {
+	opts := v.Options
+	if v.ReadOnly {
+		opts = append([]string{"ro"}, opts...)
+	}
+
+	// Singularity splits bind paths on commas, and the source, destination and options on colons,
+	// so paths containing either would be misinterpreted.
+	if strings.ContainsAny(h, ":,") {
+		return "", fmt.Errorf("invalid handle %q for volume %v", h, v.VolumeID)
+	}
+	if strings.ContainsAny(v.Location, ":,") {
+		return "", fmt.Errorf("invalid location %q for volume %v", v.Location, v.VolumeID)
+	}
+
+	// Singularity only recognizes certain options, so anything else would be misinterpreted as a
+	// bind path.
+	for _, o := range opts {
+		switch {
+		case strings.ContainsAny(o, ":,"):
+			return "", fmt.Errorf("invalid bind option %q for volume %v", o, v.VolumeID)
+		case o == "rw" && v.ReadOnly:
+			return "", fmt.Errorf("volume %v cannot be both read-only and read-write", v.VolumeID)
+		case o == "ro" || o == "rw":
+		case strings.HasPrefix(o, "image-src=") || strings.HasPrefix(o, "id="):
+		default:
+			return "", fmt.Errorf("unsupported bind option %q for volume %v", o, v.VolumeID)
+		}
+	}
+
+	bp := h + ":" + v.Location
+	if len(opts) > 0 {
+		bp += ":" + strings.Join(opts, ",")
+	}
+	return bp, nil
 }
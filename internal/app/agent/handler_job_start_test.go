@@ -0,0 +1,106 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestJobTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		max     time.Duration
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{"NoLimit", 0, 0, 0},
+		{"JobLimit", 0, time.Minute, time.Minute},
+		{"NodeLimit", time.Hour, 0, time.Hour},
+		{"JobBelowNodeLimit", time.Hour, time.Minute, time.Minute},
+		{"JobAboveNodeLimit", time.Minute, time.Hour, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Agent{maxJobTimeout: tt.max}
+			if got := a.jobTimeout(job{Timeout: tt.timeout}); got != tt.want {
+				t.Errorf("got timeout %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       volumeRequirement
+		want    string
+		wantErr bool
+	}{
+		{"ReadWrite", volumeRequirement{VolumeID: "v", Location: "/data"}, "/vol:/data", false},
+		{"ReadOnly", volumeRequirement{VolumeID: "v", Location: "/data", ReadOnly: true}, "/vol:/data:ro", false},
+		{"Options", volumeRequirement{VolumeID: "v", Location: "/data", Options: []string{"rw"}}, "/vol:/data:rw", false},
+		{"ReadOnlyOptions", volumeRequirement{VolumeID: "v", Location: "/data", ReadOnly: true, Options: []string{"image-src=/inputs"}}, "/vol:/data:ro,image-src=/inputs", false},
+		{"UnsupportedOption", volumeRequirement{VolumeID: "v", Location: "/data", Options: []string{"nosuid"}}, "", true},
+		{"CommaOption", volumeRequirement{VolumeID: "v", Location: "/data", Options: []string{"ro,/etc"}}, "", true},
+		{"Conflict", volumeRequirement{VolumeID: "v", Location: "/data", ReadOnly: true, Options: []string{"rw"}}, "", true},
+		{"EmptyOption", volumeRequirement{VolumeID: "v", Location: "/data", Options: []string{""}}, "", true},
+		{"InvalidOption", volumeRequirement{VolumeID: "v", Location: "/data", Options: []string{"a:b"}}, "", true},
+		{"CommaLocation", volumeRequirement{VolumeID: "v", Location: "/data,/etc"}, "", true},
+		{"ColonLocation", volumeRequirement{VolumeID: "v", Location: "/data:rw"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bindPath("/vol", tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got bind path %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Handles are subject to the same restrictions as locations.
+	for _, h := range []string{"/vol,/etc", "/vol:/etc"} {
+		if _, err := bindPath(h, volumeRequirement{VolumeID: "v", Location: "/data"}); err == nil {
+			t.Errorf("got nil error for handle %q", h)
+		}
+	}
+}
+
+// failingWriter fails all writes after the first n bytes.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		return w.n, errors.New("no space left on device")
+	}
+	w.n -= len(b)
+	return len(b), nil
+}
+
+func TestLogWriter(t *testing.T) {
+	var out bytes.Buffer
+	lw := &logWriter{w: &failingWriter{n: 4}, log: logrus.NewEntry(logrus.StandardLogger())}
+	w := io.MultiWriter(&out, lw)
+
+	for _, s := range []string{"abcd", "efgh", "ijkl"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	if got, want := out.String(), "abcdefghijkl"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+	if !lw.failed {
+		t.Errorf("log failure not recorded")
+	}
+}
@@ -7,12 +7,27 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	vol "github.com/sylabs/fuzzball-agent/internal/pkg/volume"
 )
 
 type volume struct {
 	ID   string
-	Name string
+	Name string // Key of persistent volumes, which defaults to the volume ID.
 	Type string
+	Size int64 // Size limit in bytes (zero for the node default).
+}
+
+// volumeResult is published when a volume operation is complete.
+type volumeResult struct {
+	Err string `json:",omitempty"`
+}
+
+// newVolumeResult returns the result of a volume operation that returned err.
+func newVolumeResult(err error) volumeResult {
+	if err != nil {
+		return volumeResult{Err: err.Error()}
+	}
+	return volumeResult{}
 }
 
 func (a *Agent) volumeCreateHandler(subject, reply string, v volume) {
@@ -20,7 +35,9 @@ func (a *Agent) volumeCreateHandler(subject, reply string, v volume) {
 		"subject":    subject,
 		"reply":      reply,
 		"volumeID":   v.ID,
+		"volumeName": v.Name,
 		"volumeType": v.Type,
+		"volumeSize": v.Size,
 	})
 	log.Print("handling volume creation")
 	defer func(t time.Time) {
@@ -33,13 +50,13 @@ func (a *Agent) volumeCreateHandler(subject, reply string, v volume) {
 	}
 
 	// Create volume.
-	err := a.vm.Create(v.ID, v.Type) // TODO: use context for cancellation?
+	err := a.vm.Create(v.ID, v.Type, vol.Options{Name: v.Name, Size: v.Size}) // TODO: use context for cancellation?
+	if err != nil {
+		log.WithError(err).Warn("failed to create volume")
+	}
 
 	// Send result.
-	res := struct {
-		Err error
-	}{err}
-	if err := a.ec.Publish(fmt.Sprintf("volume.%v.create", v.ID), res); err != nil {
+	if err := a.ec.Publish(fmt.Sprintf("volume.%v.create", v.ID), newVolumeResult(err)); err != nil {
 		log.WithError(err).Warn("failed to report volume creation")
 	}
 }
@@ -63,12 +80,43 @@ func (a *Agent) volumeDeleteHandler(subject, reply string, v volume) {
 
 	// Delete volume.
 	err := a.vm.Delete(v.ID) // TODO: use context for cancellation?
+	if err != nil {
+		log.WithError(err).Warn("failed to delete volume")
+	}
 
 	// Send result.
-	res := struct {
-		Err error
-	}{err}
-	if err := a.ec.Publish(fmt.Sprintf("volume.%v.delete", v.ID), res); err != nil {
+	if err := a.ec.Publish(fmt.Sprintf("volume.%v.delete", v.ID), newVolumeResult(err)); err != nil {
 		log.WithError(err).Warn("failed to report volume deletion")
 	}
 }
+
+func (a *Agent) volumeUsageHandler(subject, reply string, v volume) {
+	log := logrus.WithFields(logrus.Fields{
+		"subject":  subject,
+		"reply":    reply,
+		"volumeID": v.ID,
+	})
+	log.Print("handling volume usage")
+	defer func(t time.Time) {
+		log.WithField("took", time.Since(t)).Print("handled volume usage")
+	}(time.Now())
+
+	var res struct {
+		vol.Usage
+		Full bool
+		Err  string `json:",omitempty"`
+	}
+
+	u, err := a.vm.Usage(v.ID)
+	if err != nil {
+		res.Err = err.Error()
+	} else {
+		res.Usage = u
+		res.Full = u.Full()
+	}
+
+	// Send result.
+	if err := a.ec.Publish(reply, res); err != nil {
+		log.WithError(err).Warn("failed to report volume usage")
+	}
+}
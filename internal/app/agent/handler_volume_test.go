@@ -0,0 +1,31 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestVolumeResult(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"Success", nil, `{}`},
+		{"Error", errors.New("memory volume exceeds budget"), `{"Err":"memory volume exceeds budget"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(newVolumeResult(tt.err))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(b); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// idFileName is the name of the file within the state directory that holds the node ID.
+const idFileName = "node-id"
+
+// validateID ensures id is usable as a single token within a messaging system subject.
+func validateID(id string) error {
+	if id == "" {
+		return fmt.Errorf("node ID must not be empty")
+	}
+	if strings.ContainsAny(id, ".*> \t\r\n") {
+		return fmt.Errorf("node ID %q contains invalid characters", id)
+	}
+	return nil
+}
+
+// newID generates a random (version 4) UUID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// loadOrCreateID returns the node ID persisted in stateDir. If no ID has been persisted, a new
+// ID is generated and written to stateDir, so that the ID remains stable across restarts.
+func loadOrCreateID(stateDir string) (string, error) {
+	path := filepath.Join(stateDir, idFileName)
+
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		id := strings.TrimSpace(string(b))
+		if err := validateID(id); err != nil {
+			return "", fmt.Errorf("%v: %v", path, err)
+		}
+		return id, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, []byte(id+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return id, nil
+}
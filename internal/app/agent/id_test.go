@@ -0,0 +1,70 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateID(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{"Empty", "", true},
+		{"UUID", "0f8fad5b-d9cb-469f-a165-70867728950e", false},
+		{"Name", "node-1", false},
+		{"Dot", "node.1", true},
+		{"Wildcard", "node*", true},
+		{"FullWildcard", ">", true},
+		{"Space", "node 1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateID(tt.id); (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadOrCreateID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-id-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stateDir := filepath.Join(dir, "state")
+
+	// First call should generate and persist an ID.
+	id, err := loadOrCreateID(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateID(id); err != nil {
+		t.Fatalf("generated invalid ID: %v", err)
+	}
+
+	// Subsequent calls should return the persisted ID.
+	got, err := loadOrCreateID(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != id {
+		t.Errorf("got ID %v, want %v", got, id)
+	}
+
+	// A different state directory should result in a different ID.
+	other, err := loadOrCreateID(filepath.Join(dir, "other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == id {
+		t.Errorf("got duplicate ID %v", other)
+	}
+}
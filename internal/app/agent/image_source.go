@@ -0,0 +1,333 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sylabs/fuzzball-agent/internal/pkg/cache"
+	scs "github.com/sylabs/scs-library-client/client"
+)
+
+var (
+	// digestRegexp matches an OCI digest at the end of an image reference.
+	digestRegexp = regexp.MustCompile(`@(sha256:[a-f0-9]{64})$`)
+	// sha256Regexp matches a SHA-256 digest in either library (sha256.) or OCI (sha256:) form.
+	sha256Regexp = regexp.MustCompile(`^sha256[.:]([a-f0-9]{64})$`)
+)
+
+// imageSource describes a location from which an image can be pulled into the cache.
+type imageSource interface {
+	// cacheType returns the type of cache entry in which the image is stored.
+	cacheType() string
+	// hash returns the key under which the image is stored in the cache.
+	hash() string
+	// pull fetches the image to a file at path, tracking progress using p.
+	pull(ctx context.Context, path string, p *downloadProgress) error
+}
+
+// parseImageSource returns the source of the image at uri. For sources that include a hash in
+// uri, hash may be empty, or must otherwise match. For other sources, hash must be the SHA-256
+// digest of the image.
+func (a *Agent) parseImageSource(uri, hash string) (imageSource, error) {
+	// Image references are not necessarily valid URLs, so the scheme is extracted directly.
+	scheme := uri
+	if i := strings.Index(uri, ":"); i >= 0 {
+		scheme = uri[:i]
+	}
+
+	switch scheme {
+	case scs.Scheme:
+		r, tag, err := parseLibraryURI(uri)
+		if err != nil {
+			return nil, err
+		}
+		return checkHash(librarySource{r, tag, a.library}, hash)
+
+	case "docker":
+		src, err := newSingularitySource(uri, cache.DockerType, "build", a.killGracePeriod)
+		if err != nil {
+			return nil, err
+		}
+		return checkHash(src, hash)
+
+	case "oras":
+		src, err := newSingularitySource(uri, cache.ORASType, "pull", a.killGracePeriod)
+		if err != nil {
+			return nil, err
+		}
+		return checkHash(src, hash)
+
+	case "https", "file":
+		m := sha256Regexp.FindStringSubmatch(hash)
+		if m == nil {
+			return nil, fmt.Errorf("image hash must be a sha256 digest, received %q", hash)
+		}
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, err
+		}
+		// Only absolute paths on the local host can be opened.
+		if u.Scheme == "file" && (u.Host != "" || !path.IsAbs(u.Path)) {
+			return nil, fmt.Errorf("file image URI must contain an absolute path without a host, received %q", uri)
+		}
+		return directSource{u, "sha256." + m[1], a.httpClient}, nil
+	}
+	return nil, fmt.Errorf("unsupported image source: %v", uri)
+}
+
+// checkHash returns src if hash is empty or matches the hash of src, or an error otherwise.
+func checkHash(src imageSource, hash string) (imageSource, error) {
+	if hash != "" && hash != src.hash() {
+		return nil, fmt.Errorf("image hash %v does not match %v", hash, src.hash())
+	}
+	return src, nil
+}
+
+// parseLibraryURI parses a library image URI, returning the reference and image hash.
+func parseLibraryURI(uri string) (*scs.Ref, string, error) {
+	// Parse image uri
+	r, err := scs.Parse(uri)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var tag string
+	if len(r.Tags) > 0 {
+		tag = r.Tags[0]
+	}
+
+	// Ensure tag guarantees for reproducable image pulls
+	if !scs.IsImageHash(tag) {
+		return nil, "", fmt.Errorf("tag must be the image hash, received %v", tag)
+	}
+	return r, tag, nil
+}
+
+// librarySource is an image in a Sylabs library.
+type librarySource struct {
+	r   *scs.Ref
+	tag string
+	lc  LibraryConfig
+}
+
+func (s librarySource) cacheType() string {
+	return cache.SIFType
+}
+
+func (s librarySource) hash() string {
+	return s.tag
+}
+
+func (s librarySource) pull(ctx context.Context, path string, p *downloadProgress) error {
+	// Point library client to specific library if included in uri, or the configured default
+	scsConf, err := s.lc.clientConfig(s.r.Host)
+	if err != nil {
+		return err
+	}
+
+	// Initialize library client
+	client, err := scs.NewClient(scsConf)
+	if err != nil {
+		return err
+	}
+
+	// Track progress.
+	callback := func(size int64, r io.Reader, w io.Writer) error {
+		atomic.StoreInt64(&p.total, size)
+		_, err := io.Copy(io.MultiWriter(w, p), r)
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Download image from library.
+	if err := client.DownloadImage(ctx, f, runtime.GOARCH, s.r.Path, s.tag, callback); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// singularitySource is an image that is fetched into the cache using Singularity, such as an
+// image in an OCI registry. To guarantee reproducible pulls, the image reference must include a
+// digest, which is used as the cache key.
+type singularitySource struct {
+	uri    string
+	digest string
+	t      string        // Cache entry type.
+	op     string        // Singularity command used to fetch the image ("build" or "pull").
+	grace  time.Duration // Grace period used when stopping Singularity.
+}
+
+// newSingularitySource returns a source for the image at uri that will be stored in a cache
+// entry of type t, and fetched using Singularity command op.
+func newSingularitySource(uri, t, op string, grace time.Duration) (singularitySource, error) {
+	m := digestRegexp.FindStringSubmatch(uri)
+	if m == nil {
+		return singularitySource{}, fmt.Errorf("image reference must include a sha256 digest, received %v", uri)
+	}
+	return singularitySource{uri, m[1], t, op, grace}, nil
+}
+
+func (s singularitySource) cacheType() string {
+	return s.t
+}
+
+func (s singularitySource) hash() string {
+	return s.digest
+}
+
+func (s singularitySource) pull(ctx context.Context, path string, p *downloadProgress) error {
+	// Locate Singularity in PATH.
+	sing, err := exec.LookPath("singularity")
+	if err != nil {
+		return err
+	}
+
+	// Singularity writes the image in one go, so progress is only known on completion.
+	var stderr bytes.Buffer
+	args := []string{s.op, "--force", path, s.uri}
+	if _, err := runCommand(ctx, sing, args, nil, "", nil, ioutil.Discard, &stderr, s.grace, nil); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %v", err, msg)
+		}
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&p.total, fi.Size())
+	atomic.StoreInt64(&p.n, fi.Size())
+	return nil
+}
+
+// Timeouts applied to image downloads over HTTP.
+const (
+	httpConnectTimeout  = 30 * time.Second // Time to establish a connection.
+	httpResponseTimeout = 30 * time.Second // Time to receive response headers.
+	httpStallTimeout    = time.Minute      // Time without receiving data before a download is abandoned.
+)
+
+// newHTTPClient returns a client for downloading images. Connection and response timeouts are
+// applied, but no overall timeout, as large images may take a long time to download.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: httpConnectTimeout}).DialContext,
+			TLSHandshakeTimeout:   httpConnectTimeout,
+			ResponseHeaderTimeout: httpResponseTimeout,
+		},
+	}
+}
+
+// directSource is a SIF image at a URL (https:// or file://), identified by its SHA-256 digest.
+type directSource struct {
+	u      *url.URL
+	digest string       // Digest of the image, in library (sha256.) form.
+	client *http.Client // Client used for https:// URLs.
+}
+
+func (s directSource) cacheType() string {
+	return cache.SIFType
+}
+
+func (s directSource) hash() string {
+	return s.digest
+}
+
+func (s directSource) pull(ctx context.Context, path string, p *downloadProgress) error {
+	// Abandon the download if no data is received for a period.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	t := time.AfterFunc(httpStallTimeout, cancel)
+	defer t.Stop()
+
+	r, size, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	atomic.StoreInt64(&p.total, size)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sr := stallReader{r, t, httpStallTimeout}
+	if _, err := io.Copy(io.MultiWriter(f, p), sr); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("download stalled: %v", err)
+		}
+		return err
+	}
+	return f.Close()
+}
+
+// stallReader resets a timer each time data is read.
+type stallReader struct {
+	r io.Reader
+	t *time.Timer
+	d time.Duration
+}
+
+func (sr stallReader) Read(b []byte) (int, error) {
+	n, err := sr.r.Read(b)
+	if n > 0 {
+		sr.t.Reset(sr.d)
+	}
+	return n, err
+}
+
+// open opens the image, returning a reader and the size of the image (or -1 if unknown).
+func (s directSource) open(ctx context.Context) (io.ReadCloser, int64, error) {
+	if s.u.Scheme == "file" {
+		f, err := os.Open(s.u.Path)
+		if err != nil {
+			return nil, 0, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return f, fi.Size(), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, 0, fmt.Errorf("unexpected http status code: %d", res.StatusCode)
+	}
+	return res.Body, res.ContentLength, nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/fuzzball-agent/internal/pkg/cache"
+)
+
+func TestParseImageSource(t *testing.T) {
+	const (
+		hex         = "8d9bb8b4b0b4cfb4dd1bb5d5ae1bd6e7d3c1f2d0c62c5e0ac76cfbc0d8eaa5f1"
+		libraryHash = "sha256." + hex
+		digest      = "sha256:" + hex
+	)
+
+	tests := []struct {
+		name          string
+		uri           string
+		hash          string
+		wantCacheType string
+		wantHash      string
+		wantErr       bool
+	}{
+		{"Library", "library:///library/default/alpine:" + libraryHash, "", cache.SIFType, libraryHash, false},
+		{"LibraryHost", "library://library.example.com/library/default/alpine:" + libraryHash, "", cache.SIFType, libraryHash, false},
+		{"LibraryHashMatch", "library:///library/default/alpine:" + libraryHash, libraryHash, cache.SIFType, libraryHash, false},
+		{"LibraryHashMismatch", "library:///library/default/alpine:" + libraryHash, "sha256.00", "", "", true},
+		{"LibraryTag", "library:///library/default/alpine:latest", "", "", "", true},
+		{"Docker", "docker://alpine@" + digest, "", cache.DockerType, digest, false},
+		{"DockerTag", "docker://alpine:latest", "", "", "", true},
+		{"ORAS", "oras://registry.example.com/alpine@" + digest, "", cache.ORASType, digest, false},
+		{"ORASTag", "oras://registry.example.com/alpine:latest", "", "", "", true},
+		{"HTTPS", "https://images.example.com/alpine.sif", libraryHash, cache.SIFType, libraryHash, false},
+		{"HTTPSDigest", "https://images.example.com/alpine.sif", digest, cache.SIFType, libraryHash, false},
+		{"HTTPSNoHash", "https://images.example.com/alpine.sif", "", "", "", true},
+		{"File", "file:///srv/images/alpine.sif", libraryHash, cache.SIFType, libraryHash, false},
+		{"FileHost", "file://images.example.com/srv/images/alpine.sif", libraryHash, "", "", true},
+		{"FileRelative", "file:images/alpine.sif", libraryHash, "", "", true},
+		{"FileBadHash", "file:///srv/images/alpine.sif", "sif.0f8fad5b-d9cb-469f-a165-70867728950e", "", "", true},
+		{"Unsupported", "shub://alpine", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Agent{}
+			src, err := a.parseImageSource(tt.uri, tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := src.cacheType(); got != tt.wantCacheType {
+				t.Errorf("got cache type %v, want %v", got, tt.wantCacheType)
+			}
+			if got := src.hash(); got != tt.wantHash {
+				t.Errorf("got hash %v, want %v", got, tt.wantHash)
+			}
+		})
+	}
+}
+
+func TestDirectSourcePull(t *testing.T) {
+	content := []byte("image")
+	sum := sha256.Sum256(content)
+	hash := "sha256." + hex.EncodeToString(sum[:])
+
+	dir, err := ioutil.TempDir("", "test-image-source-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	imagePath := filepath.Join(dir, "image.sif")
+	if err := ioutil.WriteFile(imagePath, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewTLSServer(http.FileServer(http.Dir(dir)))
+	defer s.Close()
+
+	tests := []struct {
+		name    string
+		uri     string
+		wantErr bool
+	}{
+		{"File", "file://" + imagePath, false},
+		{"FileNotFound", "file://" + filepath.Join(dir, "missing.sif"), true},
+		{"HTTPS", s.URL + "/image.sif", false},
+		{"HTTPSNotFound", s.URL + "/missing.sif", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Agent{httpClient: s.Client()}
+			src, err := a.parseImageSource(tt.uri, hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(dir, tt.name)
+			p := &downloadProgress{total: -1}
+			err = src.pull(context.Background(), path, p)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(content) {
+				t.Errorf("got content %q, want %q", got, content)
+			}
+			if n := p.bytes(); n != int64(len(content)) {
+				t.Errorf("got %v bytes, want %v", n, len(content))
+			}
+		})
+	}
+}
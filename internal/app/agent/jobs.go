@@ -0,0 +1,89 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// jobRegistry tracks jobs that are in progress, so that they can be canceled.
+type jobRegistry struct {
+	m       sync.Mutex
+	jobs    map[string]context.CancelFunc
+	wg      sync.WaitGroup // Counts registered jobs.
+	stopped bool           // Set once all jobs are canceled, to refuse new jobs.
+}
+
+// newJobRegistry returns an empty jobRegistry.
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{
+		jobs: make(map[string]context.CancelFunc),
+	}
+}
+
+// add registers a job with the supplied ID, which can be canceled by calling cancel.
+func (r *jobRegistry) add(id string, cancel context.CancelFunc) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if _, ok := r.jobs[id]; ok {
+		return fmt.Errorf("job %s already exists", id)
+	}
+	if r.stopped {
+		return fmt.Errorf("job %s refused, agent is stopping", id)
+	}
+	r.jobs[id] = cancel
+	r.wg.Add(1)
+	return nil
+}
+
+// remove unregisters the job with the supplied ID.
+func (r *jobRegistry) remove(id string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if _, ok := r.jobs[id]; ok {
+		delete(r.jobs, id)
+		r.wg.Done()
+	}
+}
+
+// has returns true if the job with the supplied ID is in progress.
+func (r *jobRegistry) has(id string) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	_, ok := r.jobs[id]
+	return ok
+}
+
+// cancel cancels the job with the supplied ID.
+func (r *jobRegistry) cancel(id string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	cancel, ok := r.jobs[id]
+	if !ok {
+		return fmt.Errorf("job %s does not exist", id)
+	}
+	cancel()
+	return nil
+}
+
+// cancelAll cancels all jobs, and refuses jobs registered subsequently.
+func (r *jobRegistry) cancelAll() {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.stopped = true
+	for _, cancel := range r.jobs {
+		cancel()
+	}
+}
+
+// wait waits until all jobs have been removed.
+func (r *jobRegistry) wait() {
+	r.wg.Wait()
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJobRegistryCancelAll(t *testing.T) {
+	r := newJobRegistry()
+
+	var ctxs []context.Context
+	for _, id := range []string{"a", "b"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := r.add(id, cancel); err != nil {
+			t.Fatal(err)
+		}
+		ctxs = append(ctxs, ctx)
+
+		// Remove the job once it is canceled, as the job runner does.
+		go func(id string) {
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			r.remove(id)
+		}(id)
+	}
+
+	r.cancelAll()
+	for _, ctx := range ctxs {
+		if ctx.Err() != context.Canceled {
+			t.Errorf("got error %v, want %v", ctx.Err(), context.Canceled)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for jobs")
+	}
+	if r.has("a") || r.has("b") {
+		t.Errorf("jobs remain registered")
+	}
+
+	// Jobs should be refused once the registry is stopped.
+	if err := r.add("c", func() {}); err == nil {
+		t.Errorf("got nil error")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	scs "github.com/sylabs/scs-library-client/client"
+)
+
+// defaultLibraryURL is the library used when neither the image URI nor configuration specify one.
+const defaultLibraryURL = "https://library.sylabs.io"
+
+// LibraryConfig describes how to connect to Sylabs libraries.
+type LibraryConfig struct {
+	URL            string            `yaml:"url"`            // Library used when an image URI does not specify a host.
+	AuthTokenFiles map[string]string `yaml:"authTokenFiles"` // Files containing auth tokens, keyed by library host.
+	InsecureHosts  []string          `yaml:"insecureHosts"`  // Library hosts reached using plain HTTP.
+}
+
+// insecure returns true if host is to be reached using plain HTTP.
+func (lc LibraryConfig) insecure(host string) bool {
+	for _, h := range lc.InsecureHosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// clientConfig returns the library client configuration for host, which is the host specified
+// in an image URI, or empty if the default library should be used.
+func (lc LibraryConfig) clientConfig(host string) (*scs.Config, error) {
+	baseURL := lc.URL
+	if baseURL == "" {
+		baseURL = defaultLibraryURL
+	}
+	if host != "" {
+		scheme := "https"
+		if lc.insecure(host) {
+			scheme = "http"
+		}
+		baseURL = scheme + "://" + host
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Plain HTTP is only permitted for hosts that are explicitly configured, and never when an
+	// auth token would be sent in cleartext.
+	path, hasToken := lc.AuthTokenFiles[u.Host]
+	if u.Scheme == "http" {
+		if !lc.insecure(u.Host) {
+			return nil, fmt.Errorf("plain HTTP connection to library %v not permitted", u.Host)
+		}
+		if hasToken {
+			return nil, fmt.Errorf("auth token for library %v cannot be sent using plain HTTP", u.Host)
+		}
+	}
+
+	// Read auth token from file, if one is configured for the host.
+	var token string
+	if hasToken {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auth token for library %v: %v", u.Host, err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+
+	return &scs.Config{BaseURL: baseURL, AuthToken: token}, nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLibraryClientConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-library-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokenPath := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenPath, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokens := map[string]string{
+		"library.sylabs.io":   tokenPath,
+		"library.example.com": tokenPath,
+		"missing.example.com": filepath.Join(dir, "missing"),
+	}
+	insecure := []string{"localhost:8080"}
+
+	tests := []struct {
+		name        string
+		lc          LibraryConfig
+		host        string
+		wantBaseURL string
+		wantToken   string
+		wantErr     bool
+	}{
+		{"Default", LibraryConfig{}, "", "https://library.sylabs.io", "", false},
+		{"DefaultToken", LibraryConfig{AuthTokenFiles: tokens}, "", "https://library.sylabs.io", "secret", false},
+		{"URL", LibraryConfig{URL: "https://library.example.com"}, "", "https://library.example.com", "", false},
+		{"URLToken", LibraryConfig{URL: "https://library.example.com", AuthTokenFiles: tokens}, "", "https://library.example.com", "secret", false},
+		{"URLHTTP", LibraryConfig{URL: "http://library.example.com"}, "", "", "", true},
+		{"URLHTTPInsecure", LibraryConfig{URL: "http://localhost:8080", InsecureHosts: insecure}, "", "http://localhost:8080", "", false},
+		{"URLHTTPToken", LibraryConfig{URL: "http://library.example.com", AuthTokenFiles: tokens, InsecureHosts: []string{"library.example.com"}}, "", "", "", true},
+		{"Host", LibraryConfig{URL: "https://library.example.com"}, "other.example.com", "https://other.example.com", "", false},
+		{"HostToken", LibraryConfig{AuthTokenFiles: tokens}, "library.example.com", "https://library.example.com", "secret", false},
+		{"HostInsecure", LibraryConfig{InsecureHosts: insecure}, "localhost:8080", "http://localhost:8080", "", false},
+		{"HostNotInsecure", LibraryConfig{InsecureHosts: insecure}, "library.example.com", "https://library.example.com", "", false},
+		{"HostInsecureToken", LibraryConfig{AuthTokenFiles: tokens, InsecureHosts: []string{"library.example.com"}}, "library.example.com", "", "", true},
+		{"TokenMissing", LibraryConfig{AuthTokenFiles: tokens}, "missing.example.com", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.lc.clientConfig(tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := c.BaseURL; got != tt.wantBaseURL {
+				t.Errorf("got base URL %v, want %v", got, tt.wantBaseURL)
+			}
+			if got := c.AuthToken; got != tt.wantToken {
+				t.Errorf("got auth token %v, want %v", got, tt.wantToken)
+			}
+		})
+	}
+}
@@ -71,10 +71,17 @@ func (a Agent) subscribe() error {
 		handler nats.Handler
 	}{
 		{fmt.Sprintf("node.%s.job.start", a.id), a.jobStartHandler},
+		{fmt.Sprintf("node.%s.job.*.cancel", a.id), a.jobCancelHandler},
+		{fmt.Sprintf("node.%s.job.*.logs", a.id), a.jobLogsHandler},
 		{fmt.Sprintf("node.%s.volume.create", a.id), a.volumeCreateHandler},
 		{fmt.Sprintf("node.%s.volume.delete", a.id), a.volumeDeleteHandler},
+		{fmt.Sprintf("node.%s.volume.usage", a.id), a.volumeUsageHandler},
 		{fmt.Sprintf("node.%s.image.cached", a.id), a.imageCachedHandler},
+		{fmt.Sprintf("node.%s.image.cached.batch", a.id), a.imageCachedBatchHandler},
 		{fmt.Sprintf("node.%s.image.download", a.id), a.imageDownloadHandler},
+		{fmt.Sprintf("node.%s.cache.list", a.id), a.cacheListHandler},
+		{fmt.Sprintf("node.%s.cache.stats", a.id), a.cacheStatsHandler},
+		{fmt.Sprintf("node.%s.cache.evict", a.id), a.cacheEvictHandler},
 	}
 	for _, s := range subs {
 		if _, err := a.ec.Subscribe(s.subject, s.handler); err != nil {
@@ -0,0 +1,102 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// nodeInfo describes the node on which the agent is running.
+type nodeInfo struct {
+	ID          string
+	Hostname    string
+	Version     string
+	VolumeTypes []string
+	CacheDir    string
+	CPUs        int
+	Memory      uint64
+}
+
+// heartbeat is periodically published to indicate the node is alive.
+type heartbeat struct {
+	ID   string
+	Time time.Time
+}
+
+// nodeInfo returns a description of the node.
+func (a Agent) nodeInfo() nodeInfo {
+	ni := nodeInfo{
+		ID:          a.id,
+		Version:     a.version,
+		VolumeTypes: a.vm.Types(),
+		CacheDir:    a.c.Dir(),
+		CPUs:        runtime.NumCPU(),
+	}
+
+	var err error
+	if ni.Hostname, err = os.Hostname(); err != nil {
+		logrus.WithError(err).Warn("failed to get hostname")
+	}
+	if ni.Memory, err = totalMemory(); err != nil {
+		logrus.WithError(err).Warn("failed to get memory size")
+	}
+	return ni
+}
+
+// register announces the node to the service.
+func (a Agent) register() error {
+	return registerNode(a.ec, a.nodeInfo())
+}
+
+// deregister announces to the service that the node is going away.
+func (a Agent) deregister() {
+	deregisterNode(a.ec, a.id)
+}
+
+// registerNode publishes ni to announce the node to the service.
+func registerNode(p publisher, ni nodeInfo) error {
+	if err := p.Publish("node.register", ni); err != nil {
+		return err
+	}
+	logrus.WithFields(logrus.Fields{
+		"hostname":    ni.Hostname,
+		"version":     ni.Version,
+		"volumeTypes": ni.VolumeTypes,
+		"cpus":        ni.CPUs,
+		"memory":      ni.Memory,
+	}).Info("node registered")
+	return nil
+}
+
+// deregisterNode announces to the service that the node with the supplied ID is going away.
+func deregisterNode(p publisher, id string) {
+	if err := p.Publish(fmt.Sprintf("node.%v.deregister", id), nil); err != nil {
+		logrus.WithError(err).Warn("failed to deregister node")
+		return
+	}
+	logrus.Info("node deregistered")
+}
+
+// sendHeartbeats publishes a heartbeat for the node with the supplied ID every interval until
+// stop is closed.
+func sendHeartbeats(p publisher, id string, interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	subject := fmt.Sprintf("node.%v.heartbeat", id)
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-t.C:
+			if err := p.Publish(subject, heartbeat{id, now.UTC()}); err != nil {
+				logrus.WithError(err).Warn("failed to publish heartbeat")
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sylabs/fuzzball-agent/internal/pkg/cache"
+	vol "github.com/sylabs/fuzzball-agent/internal/pkg/volume"
+)
+
+// message is a message published to a subject.
+type message struct {
+	subject string
+	v       interface{}
+}
+
+// chanPublisher sends published messages to a channel, optionally failing each publish.
+type chanPublisher struct {
+	c   chan message
+	err error
+}
+
+func (p chanPublisher) Publish(subject string, v interface{}) error {
+	p.c <- message{subject, v}
+	return p.err
+}
+
+func TestNodeInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-node-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	vm, err := vol.NewManager(vol.Config{"ephemeral": {Location: dir}, "persistent": {Location: dir}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cache.New(cache.Config{CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := Agent{id: "node-1", version: "1.2.3", vm: vm, c: c}
+	ni := a.nodeInfo()
+	if ni.ID != "node-1" || ni.Version != "1.2.3" {
+		t.Errorf("got ID %v version %v, want node-1 1.2.3", ni.ID, ni.Version)
+	}
+	if want := []string{vol.TypeEphemeral, vol.TypePersistent}; len(ni.VolumeTypes) != 2 || ni.VolumeTypes[0] != want[0] || ni.VolumeTypes[1] != want[1] {
+		t.Errorf("got volume types %v, want %v", ni.VolumeTypes, want)
+	}
+	if ni.CacheDir != c.Dir() {
+		t.Errorf("got cache dir %v, want %v", ni.CacheDir, c.Dir())
+	}
+	if ni.CPUs <= 0 {
+		t.Errorf("got %v CPUs", ni.CPUs)
+	}
+}
+
+func TestRegisterNode(t *testing.T) {
+	p := chanPublisher{c: make(chan message, 1)}
+	ni := nodeInfo{ID: "node-1"}
+	if err := registerNode(p, ni); err != nil {
+		t.Fatal(err)
+	}
+	m := <-p.c
+	if m.subject != "node.register" {
+		t.Errorf("got subject %v, want node.register", m.subject)
+	}
+	if got, ok := m.v.(nodeInfo); !ok || got.ID != ni.ID {
+		t.Errorf("got payload %+v, want %+v", m.v, ni)
+	}
+
+	// Errors should be returned, so that the agent does not run unregistered.
+	p.err = errors.New("disconnected")
+	if err := registerNode(p, ni); err == nil {
+		t.Errorf("got nil error")
+	}
+}
+
+func TestDeregisterNode(t *testing.T) {
+	p := chanPublisher{c: make(chan message, 1)}
+	deregisterNode(p, "node-1")
+	if m := <-p.c; m.subject != "node.node-1.deregister" {
+		t.Errorf("got subject %v, want node.node-1.deregister", m.subject)
+	}
+}
+
+func TestSendHeartbeats(t *testing.T) {
+	p := chanPublisher{c: make(chan message)}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		sendHeartbeats(p, "node-1", time.Millisecond, stop)
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case m := <-p.c:
+			if m.subject != "node.node-1.heartbeat" {
+				t.Errorf("got subject %v, want node.node-1.heartbeat", m.subject)
+			}
+			hb, ok := m.v.(heartbeat)
+			if !ok {
+				t.Fatalf("got payload of type %T, want heartbeat", m.v)
+			}
+			if hb.ID != "node-1" || hb.Time.IsZero() || hb.Time.Location() != time.UTC {
+				t.Errorf("got heartbeat %+v", hb)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for heartbeat %v", i)
+		}
+	}
+
+	// Heartbeats should stop when stop is closed.
+	close(stop)
+	for {
+		select {
+		case <-p.c:
+			// Drain any heartbeat sent before stop was observed.
+		case <-done:
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for heartbeats to stop")
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultPrepullParallelism is the default maximum number of concurrent pre-pull downloads.
+const defaultPrepullParallelism = 2
+
+// PrepullImage describes an image to be downloaded to the cache at startup.
+type PrepullImage struct {
+	URI  string `yaml:"uri"`  // URI of the image.
+	Hash string `yaml:"hash"` // Hash of the image, required for sources that do not include one in the URI.
+}
+
+// PrepullConfig describes images to be downloaded to the cache at startup.
+type PrepullConfig struct {
+	Images      []PrepullImage `yaml:"images"`      // Images to download.
+	Parallelism int            `yaml:"parallelism"` // Maximum number of concurrent downloads.
+}
+
+// prepullImages downloads the configured images that are not already present to the cache, with
+// at most the configured number of concurrent downloads. The result for each image is passed to
+// report. No further downloads are started once stop is closed.
+func (a *Agent) prepullImages(stop <-chan struct{}, report func(imageDownloadResult, *logrus.Entry)) {
+	images := a.prepull.Images
+	if len(images) == 0 {
+		return
+	}
+
+	n := a.prepull.Parallelism
+	if n <= 0 {
+		n = defaultPrepullParallelism
+	}
+
+	log := logrus.WithFields(logrus.Fields{
+		"images":      len(images),
+		"parallelism": n,
+	})
+	log.Print("pre-pulling images")
+	defer func(t time.Time) {
+		log.WithField("took", time.Since(t)).Print("pre-pulled images")
+	}(time.Now())
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, n)
+	for _, i := range images {
+		select {
+		case <-stop:
+			log.Print("stopped pre-pulling images")
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i PrepullImage) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			log := log.WithField("imageURI", i.URI)
+			res, err := a.downloadImage(i.URI, i.Hash)
+			if err != nil {
+				log.WithError(err).Warn("could not pre-pull image")
+			}
+			report(res, log)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sylabs/fuzzball-agent/internal/pkg/cache"
+)
+
+func TestPrepullImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-prepull-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := cache.New(cache.Config{CacheDir: filepath.Join(dir, "cache")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create images to pre-pull.
+	var images []PrepullImage
+	for _, name := range []string{"a", "b", "c"} {
+		content := []byte(name)
+		sum := sha256.Sum256(content)
+		path := filepath.Join(dir, name+".sif")
+		if err := ioutil.WriteFile(path, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, PrepullImage{"file://" + path, "sha256:" + hex.EncodeToString(sum[:])})
+	}
+
+	a := Agent{
+		c:       c,
+		prepull: PrepullConfig{Images: images, Parallelism: 2},
+	}
+
+	prepull := func() map[string]imageDownloadResult {
+		var m sync.Mutex
+		results := make(map[string]imageDownloadResult)
+		a.prepullImages(make(chan struct{}), func(res imageDownloadResult, _ *logrus.Entry) {
+			m.Lock()
+			defer m.Unlock()
+			results[res.Hash] = res
+		})
+		return results
+	}
+
+	results := prepull()
+	if got, want := len(results), len(images); got != want {
+		t.Fatalf("got %v results, want %v", got, want)
+	}
+	for hash, res := range results {
+		if res.Err != "" || res.Path == "" {
+			t.Errorf("image %v: got result %+v", hash, res)
+		}
+	}
+
+	// Remove the sources, so that pre-pulling again fails if images are pulled.
+	for _, i := range images {
+		if err := os.Remove(i.URI[len("file://"):]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for hash, res := range prepull() {
+		if res.Err != "" {
+			t.Errorf("image %v: got error %v", hash, res.Err)
+		}
+		if want := results[hash].Path; res.Path != want {
+			t.Errorf("image %v: got path %v, want %v", hash, res.Path, want)
+		}
+		if res.Bytes != 0 {
+			t.Errorf("image %v: got %v bytes downloaded, want 0", hash, res.Bytes)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+// +build linux
+
+package agent
+
+import "syscall"
+
+// totalMemory returns the total usable main memory size of the node in bytes.
+func totalMemory() (uint64, error) {
+	var info syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&info); err != nil {
+		return 0, err
+	}
+	return uint64(info.Totalram) * uint64(info.Unit), nil
+}
@@ -0,0 +1,12 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+// +build !linux
+
+package agent
+
+import "errors"
+
+// totalMemory returns the total usable main memory size of the node in bytes.
+func totalMemory() (uint64, error) {
+	return 0, errors.New("memory size not supported on this platform")
+}
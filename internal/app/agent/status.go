@@ -0,0 +1,111 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// jobStatusVersion is the version of the jobStatus message format. It must be incremented when
+// an incompatible change is made to jobStatus.
+const jobStatusVersion = 1
+
+// Job states.
+const (
+	stateAccepted         = "ACCEPTED"
+	stateQueued           = "QUEUED"
+	statePullingImage     = "PULLING_IMAGE"
+	statePreparingVolumes = "PREPARING_VOLUMES"
+	stateRunning          = "RUNNING"
+	stateCompleted        = "COMPLETED"
+	stateFailed           = "FAILED"
+	stateCanceled         = "CANCELED"
+	stateTimedOut         = "TIMED_OUT"
+	stateUnverified       = "VERIFICATION_FAILED"
+)
+
+// jobStatus describes a transition in the lifecycle of a job. Every transition is published to
+// job.<id>.status, and terminal transitions are additionally published to job.<id>.finished.
+type jobStatus struct {
+	Version int
+	JobID   string
+	Status  string
+	Time    time.Time // Time of the transition.
+
+	// Set when Status is QUEUED.
+	Position int `json:",omitempty"` // Position in the queue (1-based).
+
+	// Set when Status is RUNNING.
+	PID       int        `json:",omitempty"` // Process ID of Singularity.
+	StartTime *time.Time `json:",omitempty"` // Time the process was started.
+	Verified  bool       `json:",omitempty"` // Image signatures were verified.
+
+	// Set when Status is terminal.
+	RC         int           // Process exit code.
+	Signal     string        `json:",omitempty"` // Signal that terminated the process, if any.
+	Error      string        `json:",omitempty"` // Reason for failure, if any.
+	Elapsed    time.Duration `json:",omitempty"` // Time since the job left the queue.
+	WallTime   time.Duration `json:",omitempty"` // Wall time of the process.
+	UserTime   time.Duration `json:",omitempty"` // User CPU time of the process.
+	SystemTime time.Duration `json:",omitempty"` // System CPU time of the process.
+}
+
+// isTerminal returns true if s represents the final transition of a job.
+func (s jobStatus) isTerminal() bool {
+	switch s.Status {
+	case stateCompleted, stateFailed, stateCanceled, stateTimedOut, stateUnverified:
+		return true
+	}
+	return false
+}
+
+// finishedStatus returns the terminal status of a job that was run using ctx, resulting in
+// process state ps (which may be nil) and error err.
+func finishedStatus(ctx context.Context, ps *os.ProcessState, err error) jobStatus {
+	s := jobStatus{Status: stateCompleted}
+	switch {
+	case ctx.Err() == context.Canceled:
+		s.Status = stateCanceled
+	case ctx.Err() == context.DeadlineExceeded:
+		s.Status = stateTimedOut
+	case errors.As(err, new(verifyError)):
+		s.Status = stateUnverified
+	case err != nil:
+		s.Status = stateFailed
+	}
+
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	if ps != nil {
+		s.RC = ps.ExitCode()
+		s.Signal = exitSignal(ps)
+		s.UserTime = ps.UserTime()
+		s.SystemTime = ps.SystemTime()
+	}
+	return s
+}
+
+// publishJobStatus publishes status s for the job with the supplied ID.
+func (a *Agent) publishJobStatus(id string, s jobStatus, log *logrus.Entry) {
+	s.Version = jobStatusVersion
+	s.JobID = id
+	s.Time = time.Now().UTC()
+
+	if err := a.ec.Publish(fmt.Sprintf("job.%v.status", id), s); err != nil {
+		log.WithError(err).WithField("status", s.Status).Warn("failed to report job status")
+	}
+
+	if s.isTerminal() {
+		if err := a.ec.Publish(fmt.Sprintf("job.%v.finished", id), s); err != nil {
+			log.WithError(err).Warn("failed to report job finished")
+		}
+	}
+}
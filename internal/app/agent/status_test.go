@@ -0,0 +1,47 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFinishedStatus(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expiredCtx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Hour))
+	defer cancel()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		err        error
+		wantStatus string
+		wantError  string
+	}{
+		{"Completed", context.Background(), nil, stateCompleted, ""},
+		{"Failed", context.Background(), errors.New("bad"), stateFailed, "bad"},
+		{"Canceled", canceledCtx, errors.New("signal: terminated"), stateCanceled, "signal: terminated"},
+		{"TimedOut", expiredCtx, errors.New("signal: killed"), stateTimedOut, "signal: killed"},
+		{"Unverified", context.Background(), fmt.Errorf("failed to pull image: %w", verifyError{errors.New("bad")}), stateUnverified, "failed to pull image: image signature verification failed: bad"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := finishedStatus(tt.ctx, nil, tt.err)
+			if s.Status != tt.wantStatus {
+				t.Errorf("got status %v, want %v", s.Status, tt.wantStatus)
+			}
+			if s.Error != tt.wantError {
+				t.Errorf("got error %v, want %v", s.Error, tt.wantError)
+			}
+			if !s.isTerminal() {
+				t.Errorf("got non-terminal status")
+			}
+		})
+	}
+}
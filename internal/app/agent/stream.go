@@ -3,20 +3,164 @@
 package agent
 
 import (
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
-	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
 )
 
-// stream allows for IO streaming over a NATS connection.
+// Names of job output streams.
+const (
+	streamStdout = "stdout"
+	streamStderr = "stderr"
+)
+
+const (
+	// streamFlushSize is the amount of buffered data that triggers a flush.
+	streamFlushSize = 32 * 1024
+	// streamFlushInterval is the maximum time data is buffered before being flushed.
+	streamFlushInterval = 100 * time.Millisecond
+	// chunkOverhead is a conservative estimate of the encoded size of a chunk, excluding data.
+	chunkOverhead = 256
+)
+
+var errStreamClosed = errors.New("stream closed")
+
+// publisher is the subset of nats.EncodedConn used to publish streamed output.
+type publisher interface {
+	Publish(subject string, v interface{}) error
+}
+
+// chunk is a portion of a stream, as published over NATS.
+type chunk struct {
+	Seq  uint64    // Sequence number of the chunk within the stream, starting at zero.
+	Time time.Time // Time the chunk was flushed.
+	Data []byte    `json:",omitempty"`
+	EOF  bool      `json:",omitempty"` // Set on the final chunk of a stream.
+}
+
+// stream allows for IO streaming over a NATS connection. Writes are buffered, and published as
+// a sequence of chunks when the buffer reaches a size threshold, or after a time interval.
 type stream struct {
-	id string
-	nc *nats.Conn
+	m             sync.Mutex
+	subject       string
+	p             publisher
+	maxChunk      int
+	flushSize     int
+	flushInterval time.Duration
+	buf           []byte
+	seq           uint64
+	timer         *time.Timer
+	closed        bool
+}
+
+// maxDataSize returns the maximum amount of binary data that can be included in a JSON-encoded
+// message without exceeding maxPayload.
+func maxDataSize(maxPayload int64) int {
+	n := int(maxPayload-chunkOverhead) * 3 / 4 // Allow for base64 encoding.
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// newStream returns a stream that publishes the named output stream of the job with the
+// supplied ID to job.<id>.<name>. Published chunks are sized to remain within maxPayload.
+func newStream(p publisher, maxPayload int64, id, name string) *stream {
+	maxChunk := maxDataSize(maxPayload)
+
+	flushSize := streamFlushSize
+	if flushSize > maxChunk {
+		flushSize = maxChunk
+	}
+
+	return &stream{
+		subject:       fmt.Sprintf("job.%v.%v", id, name),
+		p:             p,
+		maxChunk:      maxChunk,
+		flushSize:     flushSize,
+		flushInterval: streamFlushInterval,
+	}
 }
 
-func (s stream) Write(b []byte) (n int, err error) {
-	if err = s.nc.Publish(fmt.Sprintf("job.%v.output", s.id), b); err != nil {
-		return 0, err
+// Write buffers b, flushing if the size threshold has been reached.
+func (s *stream) Write(b []byte) (n int, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.closed {
+		return 0, errStreamClosed
+	}
+
+	s.buf = append(s.buf, b...)
+	if len(s.buf) >= s.flushSize {
+		if err := s.flush(); err != nil {
+			return 0, err
+		}
+	} else if s.timer == nil {
+		s.timer = time.AfterFunc(s.flushInterval, s.flushTimer)
 	}
 	return len(b), nil
 }
+
+// flushTimer is called when the flush interval has elapsed.
+func (s *stream) flushTimer() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.timer = nil
+	if err := s.flush(); err != nil {
+		logrus.WithField("subject", s.subject).WithError(err).Warn("failed to flush stream")
+	}
+}
+
+// flush publishes buffered data as one or more chunks. The caller must hold s.m.
+func (s *stream) flush() error {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	for b := s.buf; len(b) > 0; {
+		n := len(b)
+		if n > s.maxChunk {
+			n = s.maxChunk
+		}
+
+		if err := s.publish(chunk{Data: b[:n]}); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// publish stamps c with a sequence number and time, and publishes it. The caller must hold s.m.
+func (s *stream) publish(c chunk) error {
+	c.Seq = s.seq
+	c.Time = time.Now().UTC()
+	if err := s.p.Publish(s.subject, c); err != nil {
+		return err
+	}
+	s.seq++
+	return nil
+}
+
+// Close flushes any buffered data, and publishes an end-of-stream marker.
+func (s *stream) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.closed {
+		return errStreamClosed
+	}
+	s.closed = true
+
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.publish(chunk{EOF: true})
+}
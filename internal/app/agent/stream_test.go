@@ -0,0 +1,113 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPublisher records chunks published to it.
+type testPublisher struct {
+	m      sync.Mutex
+	chunks []chunk
+}
+
+func (p *testPublisher) Publish(subject string, v interface{}) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	c := v.(chunk)
+	c.Data = append([]byte(nil), c.Data...)
+	p.chunks = append(p.chunks, c)
+	return nil
+}
+
+func (p *testPublisher) get() []chunk {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return append([]chunk(nil), p.chunks...)
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxPayload int64
+		writes     []string
+		wantChunks int
+	}{
+		{"Empty", 1024, nil, 1},
+		{"Coalesce", 1024, []string{"a", "b", "c"}, 2},
+		{"Split", chunkOverhead + 4, []string{"abcdefgh"}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &testPublisher{}
+			s := newStream(p, tt.maxPayload, "id", streamStdout)
+			if got, want := s.subject, "job.id.stdout"; got != want {
+				t.Errorf("got subject %v, want %v", got, want)
+			}
+
+			var want bytes.Buffer
+			for _, w := range tt.writes {
+				if _, err := s.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+				want.WriteString(w)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Write([]byte("x")); err != errStreamClosed {
+				t.Errorf("got error %v, want %v", err, errStreamClosed)
+			}
+
+			chunks := p.get()
+			if got := len(chunks); got != tt.wantChunks {
+				t.Fatalf("got %v chunks, want %v", got, tt.wantChunks)
+			}
+
+			var got bytes.Buffer
+			for i, c := range chunks {
+				if c.Seq != uint64(i) {
+					t.Errorf("got sequence %v, want %v", c.Seq, i)
+				}
+				if len(c.Data) > s.maxChunk {
+					t.Errorf("got chunk of size %v, want <= %v", len(c.Data), s.maxChunk)
+				}
+				if last := i == len(chunks)-1; c.EOF != last {
+					t.Errorf("got EOF %v, want %v", c.EOF, last)
+				}
+				got.Write(c.Data)
+			}
+			if got.String() != want.String() {
+				t.Errorf("got data %v, want %v", got.String(), want.String())
+			}
+		})
+	}
+}
+
+func TestStreamFlushInterval(t *testing.T) {
+	p := &testPublisher{}
+	s := newStream(p, 1024, "id", streamStderr)
+	s.flushInterval = time.Millisecond
+
+	if _, err := s.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(p.get()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for flush")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := string(p.get()[0].Data); got != "hello" {
+		t.Errorf("got data %v, want %v", got, "hello")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+)
+
+// SignaturePolicy describes the signature verification applied to images before they are run.
+type SignaturePolicy struct {
+	Required bool   `yaml:"required"` // Require images to be signed by a key in the keyring.
+	Keyring  string `yaml:"keyring"`  // Directory containing the keyring used to verify images.
+}
+
+// validate checks that the policy is complete.
+func (sp SignaturePolicy) validate() error {
+	if sp.Required && sp.Keyring == "" {
+		return fmt.Errorf("signature verification required, but no keyring configured")
+	}
+	return nil
+}
+
+// verifyError indicates that an image failed signature verification.
+type verifyError struct {
+	err error
+}
+
+func (e verifyError) Error() string {
+	return fmt.Sprintf("image signature verification failed: %v", e.err)
+}
+
+// verifyImage verifies the signatures of the SIF image at path against the local keyring,
+// returning true if the image was verified. If the policy does not require verification, the
+// image is not checked. If verification fails, an error of type verifyError is returned.
+func (a *Agent) verifyImage(ctx context.Context, path string) (bool, error) {
+	if !a.signatures.Required {
+		return false, nil
+	}
+
+	// Locate Singularity in PATH.
+	sing, err := exec.LookPath("singularity")
+	if err != nil {
+		return false, err
+	}
+
+	// Restrict verification to keys in the configured keyring.
+	env := []string{"SINGULARITY_SYPGPDIR=" + a.signatures.Keyring}
+
+	var stderr bytes.Buffer
+	args := []string{"verify", "--local", path}
+	if _, err := runCommand(ctx, sing, args, env, "", nil, ioutil.Discard, &stderr, a.killGracePeriod, nil); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%v: %v", err, msg)
+		}
+		return false, verifyError{err}
+	}
+	return true, nil
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package agent
+
+import "testing"
+
+func TestSignaturePolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		sp      SignaturePolicy
+		wantErr bool
+	}{
+		{"NotRequired", SignaturePolicy{}, false},
+		{"Required", SignaturePolicy{Required: true, Keyring: "/etc/fuzzball/keyring"}, false},
+		{"RequiredNoKeyring", SignaturePolicy{Required: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sp.validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
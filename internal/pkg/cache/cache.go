@@ -3,39 +3,81 @@
 package cache
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 const (
 	cacheDirName = "fuzzball"
 	SIFType      = "sif"
+	DockerType   = "docker" // Images pulled from a Docker/OCI registry and converted to SIF.
+	ORASType     = "oras"   // SIF images pulled from an OCI registry using ORAS.
+
+	// tempPrefix is the prefix of temporary files used to fill cache entries.
+	tempPrefix = ".tmp-"
+	// sha256Prefix is the prefix of hashes that represent the SHA-256 digest of an entry.
+	sha256Prefix = "sha256."
 )
 
 var (
 	defaultCacheList = []string{
 		SIFType,
+		DockerType,
+		ORASType,
 	}
 )
 
 type Config struct {
-	CacheDir string `yaml:"cacheDir"`
+	CacheDir   string `yaml:"cacheDir"`
+	MaxSize    int64  `yaml:"maxSize"`    // Maximum total size of entries in bytes (zero indicates no limit).
+	MaxEntries int    `yaml:"maxEntries"` // Maximum number of entries (zero indicates no limit).
 }
 
 // Entry simply represents a filesystem location to store data.
 type Entry struct {
-	path string
+	c         *Cache
+	cacheType string
+	hash      string
+	path      string
 }
 
 type Cache struct {
 	// baseDir is one level below the directory specified in the cache configuration
 	// to ensure that cache operations are occuring on a directory only the agent controls
 	baseDir string
+
+	maxSize    int64
+	maxEntries int
+
+	m       sync.Mutex
+	flights map[string]*flight    // In-progress calls to Do, keyed by entry path.
+	index   map[string]*entryInfo // Entries present in the cache, keyed by entry path.
+	refs    map[string]int        // Reference counts of entries in use, keyed by entry path.
+	hits    uint64
+	misses  uint64
+}
+
+// flight represents an in-progress (or completed) call to Do.
+type flight struct {
+	done chan struct{}
+	v    interface{}
+	err  error
 }
 
 func New(c Config) (*Cache, error) {
 	var cache Cache
+	cache.maxSize = c.MaxSize
+	cache.maxEntries = c.MaxEntries
+	cache.flights = make(map[string]*flight)
+	cache.index = make(map[string]*entryInfo)
+	cache.refs = make(map[string]int)
 	cache.baseDir = filepath.Join(c.CacheDir, cacheDirName)
 	if err := ensureDir(cache.baseDir); err != nil {
 		return nil, err
@@ -45,7 +87,14 @@ func New(c Config) (*Cache, error) {
 		if err := ensureDir(cache.cachePath(t)); err != nil {
 			return nil, err
 		}
+		if err := removeTempFiles(cache.cachePath(t)); err != nil {
+			return nil, err
+		}
+		if err := cache.scan(t); err != nil {
+			return nil, err
+		}
 	}
+	cache.evict()
 
 	return &cache, nil
 }
@@ -69,6 +118,30 @@ func ensureDir(dir string) error {
 	return nil
 }
 
+// Types returns the types of entry stored in the cache.
+func (c *Cache) Types() []string {
+	return append([]string(nil), defaultCacheList...)
+}
+
+// Dir returns the directory in which cache entries are stored.
+func (c *Cache) Dir() string {
+	return c.baseDir
+}
+
+// removeTempFiles removes temporary files left behind in dir by interrupted fills.
+func removeTempFiles(dir string) error {
+	matches, err := filepath.Glob(filepath.Join(dir, tempPrefix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		if err := os.Remove(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *Cache) cachePath(cacheType string) string {
 	return filepath.Join(c.baseDir, cacheType)
 }
@@ -82,10 +155,136 @@ func (e *Entry) Exists() bool {
 	return !os.IsNotExist(err)
 }
 
+// Size returns the size of the entry in bytes.
+func (e *Entry) Size() (int64, error) {
+	fi, err := os.Stat(e.path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
 func (e *Entry) Path() string {
 	return e.path
 }
 
+// GetEntry returns the entry of the specified type and hash. If the entry is present in the
+// cache, it is marked as recently used.
 func (c *Cache) GetEntry(cacheType, hash string) *Entry {
-	return &Entry{c.entryPath(cacheType, hash)}
+	e := &Entry{c, cacheType, hash, c.entryPath(cacheType, hash)}
+	hit := c.touch(e.path)
+
+	c.m.Lock()
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	c.m.Unlock()
+
+	return e
+}
+
+// Lookup returns the entry of the specified type and hash, and whether it is present in the
+// cache. Unlike GetEntry, the entry is not marked as recently used, and cache statistics are not
+// updated, so Lookup is suitable for queries that do not represent use of the entry.
+func (c *Cache) Lookup(cacheType, hash string) (*Entry, bool) {
+	e := &Entry{c, cacheType, hash, c.entryPath(cacheType, hash)}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	_, ok := c.index[e.path]
+	return e, ok
+}
+
+// Fill populates the entry by calling fn with the path of a temporary file in the same directory
+// as the entry. If fn succeeds, and the hash of the entry is a SHA-256 digest that matches the
+// contents of the temporary file, the temporary file is atomically moved into place. Otherwise,
+// the temporary file is removed.
+func (e *Entry) Fill(fn func(path string) error) (err error) {
+	f, err := ioutil.TempFile(filepath.Dir(e.path), tempPrefix)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	if err := fn(tmp); err != nil {
+		return err
+	}
+	if err := verify(tmp, e.hash); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, e.path); err != nil {
+		return err
+	}
+
+	// Track the new entry, and evict entries as required to remain within limits.
+	fi, err := os.Stat(e.path)
+	if err != nil {
+		return err
+	}
+	e.c.add(e.cacheType, e.hash, fi)
+	e.c.evict()
+	return nil
+}
+
+// verify checks that the contents of the file at path match hash. Only hashes that represent
+// a SHA-256 digest are checked.
+func verify(path, hash string) error {
+	if !strings.HasPrefix(hash, sha256Prefix) {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	if got, want := hex.EncodeToString(h.Sum(nil)), strings.TrimPrefix(hash, sha256Prefix); got != want {
+		return fmt.Errorf("digest mismatch: got %v, want %v", got, want)
+	}
+	return nil
+}
+
+// Do calls fn, which is expected to populate the entry of the specified type and hash, ensuring
+// that only one call for a given entry is in progress at a time. If a call is already in
+// progress, Do waits for it to complete and returns the same result. The shared return value
+// reports whether the result was shared with other callers.
+func (c *Cache) Do(cacheType, hash string, fn func() (interface{}, error)) (v interface{}, shared bool, err error) {
+	key := c.entryPath(cacheType, hash)
+
+	c.m.Lock()
+	if f, ok := c.flights[key]; ok {
+		c.m.Unlock()
+		<-f.done
+		return f.v, true, f.err
+	}
+	f := &flight{done: make(chan struct{})}
+	c.flights[key] = f
+	c.m.Unlock()
+
+	defer func() {
+		c.m.Lock()
+		delete(c.flights, key)
+		c.m.Unlock()
+		close(f.done)
+	}()
+
+	f.v, f.err = fn()
+	return f.v, false, f.err
 }
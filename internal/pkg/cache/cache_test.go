@@ -0,0 +1,175 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestCache returns a cache configured by c, in a temporary directory that is removed by
+// the returned cleanup function.
+func newTestCache(t *testing.T, c Config) (*Cache, func()) {
+	dir, err := ioutil.TempDir("", "test-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.CacheDir = dir
+	cache, err := New(c)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return cache, func() { os.RemoveAll(dir) }
+}
+
+func TestFill(t *testing.T) {
+	content := []byte("image")
+	sum := sha256.Sum256(content)
+	digest := sha256Prefix + hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name       string
+		hash       string
+		fnErr      error
+		wantErr    bool
+		wantExists bool
+	}{
+		{"Verified", digest, nil, false, true},
+		{"Unverified", "sif.0f8fad5b-d9cb-469f-a165-70867728950e", nil, false, true},
+		{"DigestMismatch", sha256Prefix + "00", nil, true, false},
+		{"FillError", digest, errors.New("failed"), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, cleanup := newTestCache(t, Config{})
+			defer cleanup()
+
+			e := c.GetEntry(SIFType, tt.hash)
+			err := e.Fill(func(path string) error {
+				if err := ioutil.WriteFile(path, content, 0600); err != nil {
+					t.Fatal(err)
+				}
+				return tt.fnErr
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := e.Exists(); got != tt.wantExists {
+				t.Errorf("got exists %v, want %v", got, tt.wantExists)
+			}
+
+			// Temporary files should never be left behind.
+			matches, err := filepath.Glob(filepath.Join(c.cachePath(SIFType), tempPrefix+"*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(matches) != 0 {
+				t.Errorf("got temporary files %v", matches)
+			}
+		})
+	}
+}
+
+func TestNewRemovesTempFiles(t *testing.T) {
+	c, cleanup := newTestCache(t, Config{})
+	defer cleanup()
+
+	tmp := filepath.Join(c.cachePath(SIFType), tempPrefix+"interrupted")
+	if err := ioutil.WriteFile(tmp, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(Config{CacheDir: filepath.Dir(c.baseDir)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temporary file not removed")
+	}
+}
+
+func TestDo(t *testing.T) {
+	c, cleanup := newTestCache(t, Config{})
+	defer cleanup()
+
+	const n = 10
+	var calls int32
+	start := make(chan struct{})
+	results := make(chan interface{}, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _, err := c.Do(SIFType, "hash", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-start
+				return "result", nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			results <- v
+		}()
+	}
+
+	// Allow time for all callers to join the in-progress call before completing it.
+	time.Sleep(50 * time.Millisecond)
+	close(start)
+	wg.Wait()
+	close(results)
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("got %v calls, want 1", got)
+	}
+	for v := range results {
+		if v != "result" {
+			t.Errorf("got result %v, want %v", v, "result")
+		}
+	}
+
+	// Once complete, subsequent calls should not be shared.
+	_, shared, err := c.Do(SIFType, "hash", func() (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+	if err == nil {
+		t.Errorf("got nil error")
+	}
+	if shared {
+		t.Errorf("got shared result")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c, cleanup := newTestCache(t, Config{})
+	defer cleanup()
+
+	fillEntry(t, c, "a", 1)
+	before := c.List()[0].LastUsed
+	stats := c.Stats()
+
+	if _, ok := c.Lookup(SIFType, "a"); !ok {
+		t.Errorf("present entry not found")
+	}
+	if _, ok := c.Lookup(SIFType, "missing"); ok {
+		t.Errorf("missing entry found")
+	}
+
+	// Lookups should not affect stats or usage.
+	if got := c.Stats(); got != stats {
+		t.Errorf("got stats %+v, want %+v", got, stats)
+	}
+	if got := c.List()[0].LastUsed; !got.Equal(before) {
+		t.Errorf("got last used %v, want %v", got, before)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package cache
+
+import (
+	"sort"
+	"time"
+)
+
+// EntryInfo describes an entry present in the cache.
+type EntryInfo struct {
+	Type     string
+	Hash     string
+	Size     int64
+	LastUsed time.Time
+	InUse    bool
+}
+
+// Stats describes cache usage.
+type Stats struct {
+	Size    int64  // Total size of entries in bytes.
+	Entries int    // Number of entries.
+	Hits    uint64 // Number of lookups of entries that were present.
+	Misses  uint64 // Number of lookups of entries that were not present.
+}
+
+// info returns a description of the entry at path. The caller must hold c.m.
+func (c *Cache) info(path string) EntryInfo {
+	ei := c.index[path]
+	return EntryInfo{
+		Type:     ei.cacheType,
+		Hash:     ei.hash,
+		Size:     ei.size,
+		LastUsed: ei.lastUsed,
+		InUse:    c.refs[path] > 0,
+	}
+}
+
+// List returns a description of each entry present in the cache, most recently used first.
+func (c *Cache) List() []EntryInfo {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	entries := make([]EntryInfo, 0, len(c.index))
+	for path := range c.index {
+		entries = append(entries, c.info(path))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries
+}
+
+// Stats returns cache usage statistics.
+func (c *Cache) Stats() Stats {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	size, entries := c.usage()
+	return Stats{
+		Size:    size,
+		Entries: entries,
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+}
+
+// Evict removes each entry for which match returns true, returning a description of the evicted
+// entries. Entries that are in use are never evicted.
+func (c *Cache) Evict(match func(EntryInfo) bool) []EntryInfo {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	var evicted []EntryInfo
+	for path := range c.index {
+		ei := c.info(path)
+		if ei.InUse || !match(ei) {
+			continue
+		}
+		c.remove(path)
+		evicted = append(evicted, ei)
+	}
+	return evicted
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package cache
+
+import (
+	"testing"
+)
+
+func TestInventory(t *testing.T) {
+	c, cleanup := newTestCache(t, Config{})
+	defer cleanup()
+
+	fillEntry(t, c, "a", 1)
+	fillEntry(t, c, "b", 2)
+	d := fillEntry(t, c, "d", 4)
+	release := d.Acquire()
+	defer release()
+
+	// List should return most recently used first.
+	entries := c.List()
+	var hashes []string
+	for _, e := range entries {
+		hashes = append(hashes, e.Hash)
+	}
+	if got, want := len(hashes), 3; got != want {
+		t.Fatalf("got %v entries, want %v", got, want)
+	}
+	if hashes[0] != "d" || hashes[1] != "b" || hashes[2] != "a" {
+		t.Errorf("got order %v, want [d b a]", hashes)
+	}
+	if !entries[0].InUse {
+		t.Errorf("entry in use not reported as such")
+	}
+
+	// Lookups should be reflected in stats. Each fill performs one lookup of a missing entry.
+	c.GetEntry(SIFType, "a")
+	c.GetEntry(SIFType, "missing")
+	s := c.Stats()
+	if s.Size != 7 || s.Entries != 3 || s.Hits != 1 || s.Misses != 4 {
+		t.Errorf("got stats %+v", s)
+	}
+
+	// Evicting everything should leave only the entry in use.
+	evicted := c.Evict(func(EntryInfo) bool { return true })
+	if got, want := len(evicted), 2; got != want {
+		t.Errorf("got %v entries evicted, want %v", got, want)
+	}
+	if got := c.List(); len(got) != 1 || got[0].Hash != "d" {
+		t.Errorf("got entries %+v after eviction", got)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// entryInfo describes an entry present in the cache.
+type entryInfo struct {
+	cacheType string
+	hash      string
+	size      int64
+	lastUsed  time.Time
+}
+
+// scan adds entries of the specified type that are present on disk to the index. The
+// modification time of each entry is used as its last used time.
+func (c *Cache) scan(cacheType string) error {
+	fis, err := ioutil.ReadDir(c.cachePath(cacheType))
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), tempPrefix) {
+			continue
+		}
+		c.add(cacheType, fi.Name(), fi)
+	}
+	return nil
+}
+
+// add adds an entry to the index.
+func (c *Cache) add(cacheType, hash string, fi os.FileInfo) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.index[c.entryPath(cacheType, hash)] = &entryInfo{
+		cacheType: cacheType,
+		hash:      hash,
+		size:      fi.Size(),
+		lastUsed:  fi.ModTime(),
+	}
+}
+
+// touch marks the entry at path as recently used, returning true if the entry is present. The
+// modification time of the entry is also updated, so that usage persists across restarts.
+func (c *Cache) touch(path string) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	ei, ok := c.index[path]
+	if !ok {
+		return false
+	}
+
+	ei.lastUsed = time.Now()
+	if err := os.Chtimes(path, ei.lastUsed, ei.lastUsed); err != nil {
+		logrus.WithError(err).WithField("path", path).Warn("failed to update cache entry time")
+	}
+	return true
+}
+
+// Acquire marks the entry as in use, preventing it from being evicted. The caller must call
+// the returned function once the entry is no longer in use.
+func (e *Entry) Acquire() func() {
+	c := e.c
+
+	c.m.Lock()
+	c.refs[e.path]++
+	c.m.Unlock()
+
+	c.touch(e.path)
+
+	return func() {
+		c.m.Lock()
+		defer c.m.Unlock()
+
+		if c.refs[e.path]--; c.refs[e.path] <= 0 {
+			delete(c.refs, e.path)
+		}
+	}
+}
+
+// usage returns the total size and number of entries in the index. The caller must hold c.m.
+func (c *Cache) usage() (size int64, entries int) {
+	for _, ei := range c.index {
+		size += ei.size
+	}
+	return size, len(c.index)
+}
+
+// overLimit returns true if the cache exceeds its configured limits. The caller must hold c.m.
+func (c *Cache) overLimit() bool {
+	size, entries := c.usage()
+	return (c.maxSize > 0 && size > c.maxSize) || (c.maxEntries > 0 && entries > c.maxEntries)
+}
+
+// lru returns the path of the least recently used entry that is not in use. The caller must hold
+// c.m.
+func (c *Cache) lru() (string, bool) {
+	var path string
+	var oldest *entryInfo
+	for p, ei := range c.index {
+		if c.refs[p] > 0 {
+			continue
+		}
+		if oldest == nil || ei.lastUsed.Before(oldest.lastUsed) {
+			path, oldest = p, ei
+		}
+	}
+	return path, oldest != nil
+}
+
+// evict removes least recently used entries that are not in use until the cache is within its
+// configured limits.
+func (c *Cache) evict() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for c.overLimit() {
+		path, ok := c.lru()
+		if !ok {
+			logrus.Warn("cache exceeds limits, but all entries are in use")
+			return
+		}
+		c.remove(path)
+	}
+}
+
+// remove deletes the entry at path from disk and the index. The caller must hold c.m.
+func (c *Cache) remove(path string) {
+	ei := c.index[path]
+	log := logrus.WithFields(logrus.Fields{
+		"cacheType": ei.cacheType,
+		"hash":      ei.hash,
+		"size":      ei.size,
+		"lastUsed":  ei.lastUsed,
+	})
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Warn("failed to evict cache entry")
+	} else {
+		log.Info("evicted cache entry")
+	}
+	delete(c.index, path)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package cache
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func fillEntry(t *testing.T, c *Cache, hash string, size int) *Entry {
+	e := c.GetEntry(SIFType, hash)
+	err := e.Fill(func(path string) error {
+		return ioutil.WriteFile(path, make([]byte, size), 0600)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure entries have distinct last used times.
+	time.Sleep(10 * time.Millisecond)
+	return e
+}
+
+func TestEvictMaxEntries(t *testing.T) {
+	c, cleanup := newTestCache(t, Config{MaxEntries: 2})
+	defer cleanup()
+
+	a := fillEntry(t, c, "a", 1)
+	b := fillEntry(t, c, "b", 1)
+
+	// Use a, so that b is least recently used.
+	c.GetEntry(SIFType, "a")
+	time.Sleep(10 * time.Millisecond)
+
+	d := fillEntry(t, c, "d", 1)
+
+	if !a.Exists() {
+		t.Errorf("recently used entry evicted")
+	}
+	if b.Exists() {
+		t.Errorf("least recently used entry not evicted")
+	}
+	if !d.Exists() {
+		t.Errorf("new entry evicted")
+	}
+}
+
+func TestEvictMaxSize(t *testing.T) {
+	c, cleanup := newTestCache(t, Config{MaxSize: 10})
+	defer cleanup()
+
+	a := fillEntry(t, c, "a", 4)
+	b := fillEntry(t, c, "b", 4)
+	d := fillEntry(t, c, "d", 4)
+
+	if a.Exists() {
+		t.Errorf("least recently used entry not evicted")
+	}
+	if !b.Exists() || !d.Exists() {
+		t.Errorf("entry unexpectedly evicted")
+	}
+}
+
+func TestEvictInUse(t *testing.T) {
+	c, cleanup := newTestCache(t, Config{MaxEntries: 1})
+	defer cleanup()
+
+	a := fillEntry(t, c, "a", 1)
+	release := a.Acquire()
+
+	b := fillEntry(t, c, "b", 1)
+	if !a.Exists() {
+		t.Errorf("entry in use evicted")
+	}
+	if b.Exists() {
+		t.Errorf("entry not in use not evicted")
+	}
+
+	// Once released, a should be evicted in favour of a newer entry.
+	release()
+	d := fillEntry(t, c, "d", 1)
+	if a.Exists() {
+		t.Errorf("released entry not evicted")
+	}
+	if !d.Exists() {
+		t.Errorf("new entry evicted")
+	}
+}
+
+func TestScan(t *testing.T) {
+	c, cleanup := newTestCache(t, Config{})
+	defer cleanup()
+
+	for _, h := range []string{"a", "b", "d"} {
+		fillEntry(t, c, h, 1)
+	}
+
+	// Re-opening the cache with a limit should evict the oldest entries.
+	c, err := New(Config{CacheDir: filepath.Dir(c.baseDir), MaxEntries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for h, want := range map[string]bool{"a": false, "b": false, "d": true} {
+		if got := c.GetEntry(SIFType, h).Exists(); got != want {
+			t.Errorf("entry %v: got exists %v, want %v", h, got, want)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package joblog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxSize  = 10 * 1024 * 1024
+	defaultMaxFiles = 5
+	defaultMaxJobs  = 100
+	logExt          = ".log"
+)
+
+// Config describes job log configuration.
+type Config struct {
+	Dir      string        `yaml:"dir"`      // Directory in which to store job logs.
+	MaxSize  int64         `yaml:"maxSize"`  // Maximum size of a log file before it is rotated.
+	MaxFiles int           `yaml:"maxFiles"` // Maximum number of log files retained per stream.
+	MaxJobs  int           `yaml:"maxJobs"`  // Maximum number of jobs for which logs are retained.
+	MaxAge   time.Duration `yaml:"maxAge"`   // Maximum age of retained job logs (zero for no limit).
+}
+
+// Store manages job output log files. The output of each stream of a job is stored as a series
+// of files, each named by the offset within the stream at which the file begins. When a file
+// reaches the maximum size a new file is started, and the oldest files are removed so that no
+// more than the maximum number of files are retained.
+type Store struct {
+	dir      string
+	maxSize  int64
+	maxFiles int
+	maxJobs  int
+	maxAge   time.Duration
+}
+
+// New creates a new Store based on the supplied configuration.
+func New(c Config) (*Store, error) {
+	if c.Dir == "" {
+		return nil, fmt.Errorf("job log directory not specified")
+	}
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := Store{
+		dir:      c.Dir,
+		maxSize:  c.MaxSize,
+		maxFiles: c.MaxFiles,
+		maxJobs:  c.MaxJobs,
+		maxAge:   c.MaxAge,
+	}
+	if s.maxSize <= 0 {
+		s.maxSize = defaultMaxSize
+	}
+	if s.maxFiles <= 0 {
+		s.maxFiles = defaultMaxFiles
+	}
+	if s.maxJobs <= 0 {
+		s.maxJobs = defaultMaxJobs
+	}
+	return &s, nil
+}
+
+// Prune removes the logs of jobs that exceed the maximum age, and of the least recently started
+// jobs in excess of the maximum number of jobs. Logs of jobs for which active returns true are
+// retained. The IDs of jobs whose logs were removed are returned.
+func (s *Store) Prune(active func(jobID string) bool) ([]string, error) {
+	fis, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []os.FileInfo
+	for _, fi := range fis {
+		if fi.IsDir() && !active(fi.Name()) {
+			jobs = append(jobs, fi)
+		}
+	}
+
+	// Order from most to least recently started.
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ModTime().After(jobs[j].ModTime()) })
+
+	var pruned []string
+	for i, fi := range jobs {
+		if i < s.maxJobs && (s.maxAge <= 0 || time.Since(fi.ModTime()) <= s.maxAge) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, fi.Name())); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, fi.Name())
+	}
+	return pruned, nil
+}
+
+// validateName ensures name is safe to use as a path component.
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	return nil
+}
+
+// streamDir returns the directory containing logs for the specified job stream.
+func (s *Store) streamDir(jobID, stream string) (string, error) {
+	if err := validateName(jobID); err != nil {
+		return "", err
+	}
+	if err := validateName(stream); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, jobID, stream), nil
+}
+
+// logFile describes a single file in a job stream log.
+type logFile struct {
+	path  string
+	start int64 // Offset within the stream at which the file begins.
+	size  int64
+}
+
+// listFiles returns the log files in dir, ordered by start offset.
+func listFiles(dir string) ([]logFile, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []logFile
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(name, logExt) {
+			continue
+		}
+		start, err := strconv.ParseInt(strings.TrimSuffix(name, logExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, logFile{filepath.Join(dir, name), start, fi.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].start < files[j].start })
+	return files, nil
+}
+
+// Writer writes to a job stream log, rotating files as required.
+type Writer struct {
+	dir      string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	start    int64
+	size     int64
+}
+
+// Create returns a Writer for the specified job stream. Any existing log for the stream is
+// replaced.
+func (s *Store) Create(jobID, stream string) (*Writer, error) {
+	dir, err := s.streamDir(jobID, stream)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	w := Writer{
+		dir:      dir,
+		maxSize:  s.maxSize,
+		maxFiles: s.maxFiles,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// open creates a new log file starting at the current offset.
+func (w *Writer) open() (err error) {
+	path := filepath.Join(w.dir, strconv.FormatInt(w.start, 10)+logExt)
+	w.f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	return err
+}
+
+// rotate closes the current log file, opens a new one, and removes old files.
+func (w *Writer) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	w.start += w.size
+	w.size = 0
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	files, err := listFiles(w.dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > w.maxFiles {
+		if err := os.Remove(files[0].path); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// Write writes b to the log, rotating as required.
+func (w *Writer) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		if w.size >= w.maxSize {
+			if err := w.rotate(); err != nil {
+				return written, err
+			}
+		}
+
+		n := int64(len(b))
+		if r := w.maxSize - w.size; n > r {
+			n = r
+		}
+		m, err := w.f.Write(b[:n])
+		written += m
+		w.size += int64(m)
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// Close closes the log.
+func (w *Writer) Close() error {
+	return w.f.Close()
+}
+
+// Read returns up to limit bytes from the specified job stream, starting at offset. If data
+// prior to offset is no longer retained, data is returned from the earliest available offset.
+// The offset of the returned data is returned along with the data.
+func (s *Store) Read(jobID, stream string, offset int64, limit int) ([]byte, int64, error) {
+	dir, err := s.streamDir(jobID, stream)
+	if err != nil {
+		return nil, 0, err
+	}
+	files, err := listFiles(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(files) == 0 {
+		return nil, offset, nil
+	}
+
+	if offset < files[0].start {
+		offset = files[0].start
+	}
+
+	var buf bytes.Buffer
+	for _, lf := range files {
+		if buf.Len() >= limit {
+			break
+		}
+		pos := offset + int64(buf.Len())
+		if pos >= lf.start+lf.size {
+			continue
+		}
+		if err := readFile(&buf, lf.path, pos-lf.start, limit-buf.Len()); err != nil {
+			return nil, 0, err
+		}
+	}
+	return buf.Bytes(), offset, nil
+}
+
+// readFile appends up to n bytes from the file at path, starting at offset, to buf.
+func readFile(buf *bytes.Buffer, path string, offset int64, n int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.CopyN(buf, f, int64(n))
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Tail returns up to the last lines lines from the specified job stream, limited to limit bytes.
+// The offset of the returned data is returned along with the data.
+func (s *Store) Tail(jobID, stream string, lines, limit int) ([]byte, int64, error) {
+	dir, err := s.streamDir(jobID, stream)
+	if err != nil {
+		return nil, 0, err
+	}
+	files, err := listFiles(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(files) == 0 {
+		return nil, 0, nil
+	}
+
+	// Read all retained data. This is bounded by the size and number of log files.
+	start := files[0].start
+	last := files[len(files)-1]
+	b, _, err := s.Read(jobID, stream, start, int(last.start+last.size-start))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Walk back over the requested number of lines, ignoring any trailing newline.
+	i := len(b)
+	if i > 0 && b[i-1] == '\n' {
+		i--
+	}
+	for n := 0; n < lines && i >= 0; n++ {
+		i = bytes.LastIndexByte(b[:i], '\n')
+	}
+	i++
+	if lines <= 0 {
+		i = len(b)
+	}
+
+	// Apply limit, keeping the most recent data.
+	if len(b)-i > limit {
+		i = len(b) - limit
+	}
+	return b[i:], start + int64(i), nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package joblog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T, maxSize int64, maxFiles int) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "test-joblog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(Config{Dir: dir, MaxSize: maxSize, MaxFiles: maxFiles})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func writeLog(t *testing.T, s *Store, jobID, stream string, writes ...string) {
+	w, err := s.Create(jobID, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, d := range writes {
+		if _, err := w.Write([]byte(d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	s, cleanup := newTestStore(t, 4, 2)
+	defer cleanup()
+
+	// With a max size of 4 and 2 files retained, only the last 8 bytes should remain.
+	writeLog(t, s, "job", "stdout", "0123", "456789", "abcdef")
+
+	tests := []struct {
+		name       string
+		offset     int64
+		limit      int
+		wantData   string
+		wantOffset int64
+	}{
+		{"Expired", 0, 100, "89abcdef", 8},
+		{"Middle", 10, 3, "abc", 10},
+		{"SpanFiles", 9, 4, "9abc", 9},
+		{"End", 16, 100, "", 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, offset, err := s.Read("job", "stdout", tt.offset, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(b); got != tt.wantData {
+				t.Errorf("got data %q, want %q", got, tt.wantData)
+			}
+			if offset != tt.wantOffset {
+				t.Errorf("got offset %v, want %v", offset, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestTail(t *testing.T) {
+	s, cleanup := newTestStore(t, 1024, 2)
+	defer cleanup()
+
+	writeLog(t, s, "job", "stderr", "one\ntwo\n", "three\n")
+
+	tests := []struct {
+		name       string
+		lines      int
+		limit      int
+		wantData   string
+		wantOffset int64
+	}{
+		{"None", 0, 100, "", 14},
+		{"One", 1, 100, "three\n", 8},
+		{"Two", 2, 100, "two\nthree\n", 4},
+		{"All", 10, 100, "one\ntwo\nthree\n", 0},
+		{"Limit", 2, 3, "ee\n", 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, offset, err := s.Tail("job", "stderr", tt.lines, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(b); got != tt.wantData {
+				t.Errorf("got data %q, want %q", got, tt.wantData)
+			}
+			if offset != tt.wantOffset {
+				t.Errorf("got offset %v, want %v", offset, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestInvalidName(t *testing.T) {
+	s, cleanup := newTestStore(t, 0, 0)
+	defer cleanup()
+
+	for _, id := range []string{"", ".", "..", "../job", "a/b"} {
+		if _, err := s.Create(id, "stdout"); err == nil {
+			t.Errorf("got nil error for job ID %q", id)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-joblog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := New(Config{Dir: dir, MaxJobs: 2, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create logs for jobs started at different times, oldest first.
+	now := time.Now()
+	jobs := []struct {
+		id  string
+		age time.Duration
+	}{
+		{"expired", 2 * time.Hour},
+		{"active", 90 * time.Minute},
+		{"old", 3 * time.Minute},
+		{"newer", 2 * time.Minute},
+		{"newest", time.Minute},
+	}
+	for _, j := range jobs {
+		writeLog(t, s, j.id, "stdout", "data")
+		mtime := now.Add(-j.age)
+		if err := os.Chtimes(filepath.Join(dir, j.id), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := s.Prune(func(id string) bool { return id == "active" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 {
+		t.Errorf("got %v pruned, want 2", pruned)
+	}
+
+	for _, j := range []struct {
+		id   string
+		want bool
+	}{
+		{"expired", false},
+		{"active", true},
+		{"old", false},
+		{"newer", true},
+		{"newest", true},
+	} {
+		_, err := os.Stat(filepath.Join(dir, j.id))
+		if got := err == nil; got != j.want {
+			t.Errorf("job %v: got retained %v, want %v", j.id, got, j.want)
+		}
+	}
+}
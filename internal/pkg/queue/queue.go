@@ -0,0 +1,187 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Config describes the resources available for concurrent use. A zero value for any field
+// indicates no limit.
+type Config struct {
+	MaxJobs int    `yaml:"maxJobs"`
+	CPUs    int    `yaml:"cpus"`
+	Memory  uint64 `yaml:"memory"`
+}
+
+// Request describes the resources required by a single job.
+type Request struct {
+	CPUs   int
+	Memory uint64
+}
+
+// waiter represents a request waiting in the queue.
+type waiter struct {
+	r        Request
+	position int
+	notify   func(int)
+	ready    chan struct{}
+}
+
+// Queue admits requests for resources in FIFO order.
+type Queue struct {
+	m       sync.Mutex
+	c       Config
+	jobs    int
+	cpus    int
+	memory  uint64
+	waiting []*waiter
+}
+
+// New creates a new Queue based on the supplied configuration.
+func New(c Config) *Queue {
+	return &Queue{c: c}
+}
+
+// check ensures r could ever be satisfied by the queue.
+func (q *Queue) check(r Request) error {
+	if r.CPUs < 0 {
+		return fmt.Errorf("requested %v CPUs, which is negative", r.CPUs)
+	}
+	if q.c.CPUs > 0 && r.CPUs > q.c.CPUs {
+		return fmt.Errorf("requested %v CPUs, but only %v available", r.CPUs, q.c.CPUs)
+	}
+	if q.c.Memory > 0 && r.Memory > q.c.Memory {
+		return fmt.Errorf("requested %v bytes of memory, but only %v available", r.Memory, q.c.Memory)
+	}
+	return nil
+}
+
+// fits returns true if resources are currently available to satisfy r.
+func (q *Queue) fits(r Request) bool {
+	if q.c.MaxJobs > 0 && q.jobs+1 > q.c.MaxJobs {
+		return false
+	}
+	if q.c.CPUs > 0 && q.cpus+r.CPUs > q.c.CPUs {
+		return false
+	}
+	if q.c.Memory > 0 && q.memory+r.Memory > q.c.Memory {
+		return false
+	}
+	return true
+}
+
+// take marks the resources described by r as in use.
+func (q *Queue) take(r Request) {
+	q.jobs++
+	q.cpus += r.CPUs
+	q.memory += r.Memory
+}
+
+// give marks the resources described by r as available.
+func (q *Queue) give(r Request) {
+	q.jobs--
+	q.cpus -= r.CPUs
+	q.memory -= r.Memory
+}
+
+// dispatch admits waiters from the head of the queue while resources are available, and
+// notifies remaining waiters of any change in position. The caller must hold q.m.
+func (q *Queue) dispatch() {
+	for len(q.waiting) > 0 && q.fits(q.waiting[0].r) {
+		w := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		q.take(w.r)
+		close(w.ready)
+	}
+
+	for i, w := range q.waiting {
+		if pos := i + 1; pos != w.position {
+			w.position = pos
+			w.notify(pos)
+		}
+	}
+}
+
+// remove removes w from the queue. The caller must hold q.m.
+func (q *Queue) remove(w *waiter) {
+	for i, v := range q.waiting {
+		if v == w {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// releaser returns a function that makes the resources described by r available again. The
+// returned function may be called more than once.
+func (q *Queue) releaser(r Request) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.m.Lock()
+			defer q.m.Unlock()
+
+			q.give(r)
+			q.dispatch()
+		})
+	}
+}
+
+// Acquire waits until the resources described by r are available, and marks them as in use.
+// The caller must call the returned function to release the resources once they are no longer
+// required.
+//
+// If r cannot be satisfied immediately, it is placed at the back of the queue. Each time the
+// position of r within the queue changes, notify is called with its (1-based) position. notify
+// must not block or call back into the Queue.
+//
+// If ctx is done before resources are available, r is removed from the queue and an error is
+// returned.
+func (q *Queue) Acquire(ctx context.Context, r Request, notify func(int)) (func(), error) {
+	if err := q.check(r); err != nil {
+		return nil, err
+	}
+
+	q.m.Lock()
+
+	// Admit immediately if nothing is ahead of us, and resources are available.
+	if len(q.waiting) == 0 && q.fits(r) {
+		q.take(r)
+		q.m.Unlock()
+		return q.releaser(r), nil
+	}
+
+	w := &waiter{
+		r:      r,
+		notify: notify,
+		ready:  make(chan struct{}),
+	}
+	q.waiting = append(q.waiting, w)
+	w.position = len(q.waiting)
+	w.notify(w.position)
+	q.m.Unlock()
+
+	select {
+	case <-w.ready:
+		return q.releaser(r), nil
+	case <-ctx.Done():
+	}
+
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	// The request may have been admitted concurrently, in which case the resources must be
+	// given back.
+	select {
+	case <-w.ready:
+		q.give(r)
+	default:
+		q.remove(w)
+	}
+	q.dispatch()
+
+	return nil, ctx.Err()
+}
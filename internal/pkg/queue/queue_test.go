@@ -0,0 +1,142 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueueUnlimited(t *testing.T) {
+	q := New(Config{})
+
+	for i := 0; i < 100; i++ {
+		_, err := q.Acquire(context.Background(), Request{CPUs: 64, Memory: 1 << 40}, func(int) {
+			t.Fatalf("unexpected notification")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestQueueCapacity(t *testing.T) {
+	q := New(Config{CPUs: 4, Memory: 1024})
+
+	tests := []struct {
+		name    string
+		r       Request
+		wantErr bool
+	}{
+		{"Fits", Request{CPUs: 4, Memory: 1024}, false},
+		{"TooManyCPUs", Request{CPUs: 5}, true},
+		{"TooMuchMemory", Request{Memory: 1025}, true},
+		{"NegativeCPUs", Request{CPUs: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release, err := q.Acquire(context.Background(), tt.r, func(int) {})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if release != nil {
+				release()
+			}
+		})
+	}
+}
+
+func TestQueueNegativeCPUs(t *testing.T) {
+	q := New(Config{CPUs: 4})
+
+	// A negative request must not free up CPUs for other requests.
+	if _, err := q.Acquire(context.Background(), Request{CPUs: -4}, func(int) {}); err == nil {
+		t.Fatalf("got nil error")
+	}
+	release, err := q.Acquire(context.Background(), Request{CPUs: 4}, func(int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Acquire(ctx, Request{CPUs: 1}, func(int) {}); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestQueueFIFO(t *testing.T) {
+	q := New(Config{MaxJobs: 1})
+
+	release, err := q.Acquire(context.Background(), Request{}, func(int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Queue up a number of requests, recording positions and order of admission.
+	const n = 3
+	positions := make([]chan int, n)
+	admitted := make(chan int, n)
+	for i := 0; i < n; i++ {
+		positions[i] = make(chan int, n)
+		queued := make(chan struct{})
+		go func(i int) {
+			r, err := q.Acquire(context.Background(), Request{}, func(pos int) {
+				positions[i] <- pos
+				if pos == i+1 {
+					close(queued)
+				}
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			admitted <- i
+			r()
+		}(i)
+		<-queued
+	}
+
+	// Releasing should admit requests in order.
+	release()
+	for i := 0; i < n; i++ {
+		select {
+		case got := <-admitted:
+			if got != i {
+				t.Errorf("got request %v admitted, want %v", got, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for request %v", i)
+		}
+	}
+
+	// The last request should have moved up the queue one position at a time.
+	want := []int{3, 2, 1}
+	for _, w := range want {
+		if got := <-positions[n-1]; got != w {
+			t.Errorf("got position %v, want %v", got, w)
+		}
+	}
+}
+
+func TestQueueCancel(t *testing.T) {
+	q := New(Config{MaxJobs: 1})
+
+	release, err := q.Acquire(context.Background(), Request{}, func(int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := q.Acquire(ctx, Request{}, func(int) {}); err != context.DeadlineExceeded {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if len(q.waiting) != 0 {
+		t.Errorf("got %v waiting, want 0", len(q.waiting))
+	}
+}
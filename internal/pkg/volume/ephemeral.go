@@ -3,30 +3,160 @@
 package volume
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
 )
 
+// ephemeralPrefix is the prefix of ephemeral and memory volume directories, which allows
+// directories left by volumes that no longer exist to be identified.
+const ephemeralPrefix = "fuzzball-volume-"
+
 type ephemeralDriver struct {
 	baseDir string
+	maxSize int64
 }
 
 func (ed ephemeralDriver) new() handler {
-	return &ephemeral{baseDir: ed.baseDir}
+	return &ephemeral{baseDir: ed.baseDir, maxSize: ed.maxSize}
+}
+
+// gc removes ephemeral volume directories and images within the base directory that are not in
+// use.
+func (ed ephemeralDriver) gc(inUse map[string]bool) error {
+	return removeOrphans(ed.baseDir, inUse)
+}
+
+// removeOrphans removes volume directories and images within baseDir that are not in use,
+// unmounting them as required.
+func removeOrphans(baseDir string, inUse map[string]bool) error {
+	fis, err := ioutil.ReadDir(baseDir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range fis {
+		path := filepath.Join(baseDir, fi.Name())
+		if !strings.HasPrefix(fi.Name(), ephemeralPrefix) || inUse[strings.TrimSuffix(path, imageExt)] {
+			continue
+		}
+
+		log := logrus.WithField("path", path)
+		if fi.IsDir() && isMountPoint(path) {
+			if err := unmount(path); err != nil {
+				log.WithError(err).Warn("failed to unmount orphaned volume")
+				continue
+			}
+		}
+
+		log.Info("removing orphaned volume")
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// ephemeral represents a short lived volume that does not retain data.
+// ephemeral represents a short lived volume that does not retain data. If a size limit applies,
+// the volume is backed by a sparse filesystem image of that size.
 type ephemeral struct {
 	baseDir string
+	maxSize int64
 	path    string
+	size    int64 // Size limit, or zero if unlimited.
 }
 
-func (e *ephemeral) create(id string) (err error) {
-	e.path, err = ioutil.TempDir(e.baseDir, id)
-	return err
+// limit returns the size limit of a volume created with the requested size, which is capped by
+// maxSize (if non-zero).
+func limit(size, maxSize int64) int64 {
+	if maxSize > 0 && (size <= 0 || size > maxSize) {
+		return maxSize
+	}
+	if size < 0 {
+		return 0
+	}
+	return size
+}
+
+func (e *ephemeral) create(id string, o Options) error {
+	size := limit(o.Size, e.maxSize)
+	if size > 0 {
+		if err := checkMountPrivileges(); err != nil {
+			return fmt.Errorf("size limited ephemeral volumes are not supported: %v", err)
+		}
+	}
+
+	path, err := ioutil.TempDir(e.baseDir, ephemeralPrefix+id+"-")
+	if err != nil {
+		return err
+	}
+
+	// Back the volume with an image to enforce the size limit, if any.
+	if size > 0 {
+		if err := e.mount(path, size); err != nil {
+			os.RemoveAll(path)
+			return err
+		}
+		e.size = size
+	}
+
+	e.path = path
+	return nil
+}
+
+// mount creates an image of the supplied size, and mounts it on path.
+func (e *ephemeral) mount(path string, size int64) error {
+	image := path + imageExt
+	if err := createImage(image, size); err != nil {
+		return fmt.Errorf("failed to create volume image: %v", err)
+	}
+	if err := mountImage(image, path); err != nil {
+		os.Remove(image)
+		return fmt.Errorf("failed to mount volume image: %v", err)
+	}
+	return nil
+}
+
+func (e *ephemeral) restore(handle string, o Options) error {
+	fi, err := os.Stat(handle)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", handle)
+	}
+
+	// Remount the backing image, if any, which will not be mounted if the node has restarted.
+	image := handle + imageExt
+	if fi, err := os.Stat(image); err == nil {
+		if !isMountPoint(handle) {
+			if err := mountImage(image, handle); err != nil {
+				return fmt.Errorf("failed to mount volume image: %v", err)
+			}
+		}
+		e.size = fi.Size()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	e.path = handle
+	return nil
 }
 
 func (e ephemeral) delete() error {
+	if e.size > 0 {
+		if err := unmount(e.path); err != nil {
+			return err
+		}
+		if err := os.Remove(e.path + imageExt); err != nil {
+			return err
+		}
+	}
+
 	if err := os.RemoveAll(e.path); err != nil {
 		return err
 	}
@@ -37,3 +167,18 @@ func (e ephemeral) delete() error {
 func (e ephemeral) handle() string {
 	return e.path
 }
+
+func (e ephemeral) usage() (Usage, error) {
+	if e.size > 0 {
+		return fsUsage(e.path)
+	}
+	return dirUsage(e.path)
+}
+
+func (e ephemeral) limited() bool {
+	return e.size > 0
+}
+
+func (ephemeral) durable() bool {
+	return true
+}
@@ -5,6 +5,7 @@ package volume
 import (
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
 )
@@ -22,7 +23,7 @@ func TestEphemeral(t *testing.T) {
 		baseDir: baseDir,
 	}
 
-	err = e.create(testID)
+	err = e.create(testID, Options{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -49,3 +50,92 @@ func TestEphemeral(t *testing.T) {
 		t.Fatalf("failed to remove ephemeral volume location")
 	}
 }
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int64
+		size    int64
+		want    int64
+	}{
+		{"Unlimited", 0, 0, 0},
+		{"Requested", 0, 1024, 1024},
+		{"Default", 4096, 0, 4096},
+		{"WithinMax", 4096, 1024, 1024},
+		{"Capped", 4096, 8192, 4096},
+		{"Negative", 0, -1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limit(tt.size, tt.maxSize); got != tt.want {
+				t.Errorf("got limit %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEphemeralSizeLimit(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("mounting volume images requires root")
+	}
+	for _, cmd := range []string{"mkfs.ext4", "mount", "umount", "mountpoint"} {
+		if _, err := exec.LookPath(cmd); err != nil {
+			t.Skipf("%v not found", cmd)
+		}
+	}
+
+	baseDir, err := ioutil.TempDir("", "test-ephemeral-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	const size = 4 * 1024 * 1024
+	e := ephemeral{baseDir: baseDir}
+	if err := e.create("TestID", Options{Size: size}); err != nil {
+		t.Skipf("failed to create size limited volume: %v", err)
+	}
+	defer e.delete()
+
+	if !e.limited() {
+		t.Fatalf("volume not limited")
+	}
+
+	// Writing more than the limit should fail, and leave the volume full.
+	f, err := os.Create(filepath.Join(e.handle(), "test-file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	b := make([]byte, 4096)
+	for n := 0; err == nil; n += len(b) {
+		if n > size {
+			t.Fatalf("wrote beyond size limit")
+		}
+		_, err = f.Write(b)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := e.usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Limit <= 0 || u.Limit > size {
+		t.Errorf("got limit %v, want (0, %v]", u.Limit, size)
+	}
+	if !u.Full() {
+		t.Errorf("got used %v of %v, want full", u.Used, u.Limit)
+	}
+
+	if err := e.delete(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{e.handle(), e.handle() + imageExt} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%v not removed", path)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package volume
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Journal operations.
+const (
+	opCreate = "create"
+	opDelete = "delete"
+)
+
+// record is a single entry in the volume journal.
+type record struct {
+	Op      string
+	ID      string
+	Type    string  `json:",omitempty"`
+	Options Options // Options with which the volume was created.
+	Handle  string  `json:",omitempty"` // Filesystem location of the volume.
+}
+
+// journal records volume operations in a file, so that volumes can be restored when the agent
+// restarts. A journal with an empty path records nothing.
+type journal struct {
+	path string
+}
+
+// load replays the journal, returning a record of each volume that has been created, but not
+// deleted.
+func (j journal) load() (map[string]record, error) {
+	volumes := make(map[string]record)
+	if j.path == "" {
+		return volumes, nil
+	}
+
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return volumes, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var r record
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			// A partial record may be left if the agent stopped while writing.
+			logrus.WithError(err).WithField("path", j.path).Warn("ignoring malformed volume journal record")
+			continue
+		}
+
+		switch r.Op {
+		case opCreate:
+			volumes[r.ID] = r
+		case opDelete:
+			delete(volumes, r.ID)
+		}
+	}
+	return volumes, s.Err()
+}
+
+// append adds r to the journal.
+func (j journal) append(r record) error {
+	if j.path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// rewrite replaces the contents of the journal with rs.
+func (j journal) rewrite(rs []record) (err error) {
+	if j.path == "" {
+		return nil
+	}
+
+	dir := filepath.Dir(j.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, filepath.Base(j.path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	defer f.Close()
+
+	e := json.NewEncoder(f)
+	for _, r := range rs {
+		if err := e.Encode(r); err != nil {
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), j.path)
+}
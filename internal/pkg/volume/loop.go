@@ -0,0 +1,74 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package volume
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// imageExt is the extension of the image file that backs a size-limited volume. The image is
+// stored alongside the volume directory, with the same name.
+const imageExt = ".img"
+
+// checkMountPrivileges returns an error if the agent lacks the privileges required to mount
+// filesystems. The mount command refuses filesystems not listed in fstab unless run as root, even
+// if CAP_SYS_ADMIN is held, so root is required.
+func checkMountPrivileges() error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("mounting volumes requires the agent to run as root")
+	}
+	return nil
+}
+
+// run runs the named command, returning an error that includes any output if it fails.
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %v: %s", name, err, msg)
+		}
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// createImage creates a sparse image of the supplied size at path, containing an empty ext4
+// filesystem with no reserved blocks.
+func createImage(path string, size int64) (err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+	defer f.Close()
+
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return run("mkfs.ext4", "-q", "-F", "-m", "0", path)
+}
+
+// mountImage mounts the image at path on dir using a loop device.
+func mountImage(path, dir string) error {
+	return run("mount", "-o", "loop", path, dir)
+}
+
+// unmount unmounts the filesystem mounted on dir.
+func unmount(dir string) error {
+	return run("umount", dir)
+}
+
+// isMountPoint returns true if a filesystem is mounted on dir.
+func isMountPoint(dir string) bool {
+	return run("mountpoint", "-q", dir) == nil
+}
@@ -4,6 +4,7 @@ package volume
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -15,6 +16,8 @@ const (
 	TypeEphemeral = "EPHEMERAL"
 	// TypePersistent represents a volume that leaves data intact during creation and removal.
 	TypePersistent = "PERSISTENT"
+	// TypeMemory represents a short lived volume that is held in memory and does not retain data.
+	TypeMemory = "MEMORY"
 )
 
 // Config describes volume manager configuration.
@@ -23,19 +26,37 @@ type Config map[string]Spec
 // Spec defines a local resource to use as a volume.
 type Spec struct {
 	Location string `yaml:"location"`
+	MaxSize  int64  `yaml:"maxSize"` // Maximum size of an ephemeral or memory volume in bytes (zero for no limit).
+	Budget   int64  `yaml:"budget"`  // Total size of all memory volumes in bytes (zero for no limit).
+}
+
+// Options describes a volume to be created.
+type Options struct {
+	Name string // Name of the volume, used as a stable key for persistent volumes (defaults to the ID).
+	Size int64  // Size limit of the volume in bytes (zero for the default).
 }
 
 // driver is specific to a volume type and generates handlers
 // for individual instances of a volume.
 type driver interface {
 	new() handler
+	// gc removes any data left by volumes that are not in use, given the handles of volumes that
+	// are in use.
+	gc(inUse map[string]bool) error
 }
 
 // handler manages a single instance of a volume for a workflow.
 type handler interface {
-	create(string) error
+	create(string, Options) error
+	// restore reinstates a volume previously created with the supplied options and handle.
+	restore(string, Options) error
 	delete() error
 	handle() string
+	usage() (Usage, error)
+	// limited returns true if the size of the volume is limited.
+	limited() bool
+	// durable returns true if the volume is retained when the agent stops.
+	durable() bool
 }
 
 // Manager creates and tracks volumes in use.
@@ -43,13 +64,17 @@ type Manager struct {
 	m       sync.Mutex
 	support map[string]driver
 	volumes map[string]handler
+	j       journal
 }
 
-// NewManager creates a new Manager based on the supplied volume configuration.
-func NewManager(c Config) (*Manager, error) {
+// NewManager creates a new Manager based on the supplied volume configuration. If statePath is
+// not empty, volume operations are journaled to it, and volumes that existed when the agent last
+// stopped are restored. Data left by volumes that could not be restored is removed.
+func NewManager(c Config, statePath string) (*Manager, error) {
 	var m Manager
 	m.support = make(map[string]driver)
 	m.volumes = make(map[string]handler)
+	m.j = journal{path: statePath}
 
 	// read from config and register driver for different types.
 	for t, v := range c {
@@ -57,9 +82,20 @@ func NewManager(c Config) (*Manager, error) {
 		var d driver
 		switch t {
 		case TypeEphemeral:
-			d = &ephemeralDriver{baseDir: v.Location}
+			// Size limits are enforced by mounting an image, which requires privileges.
+			if v.MaxSize > 0 {
+				if err := checkMountPrivileges(); err != nil {
+					return nil, fmt.Errorf("ephemeral volume maxSize is configured, but %v", err)
+				}
+			}
+			d = &ephemeralDriver{baseDir: v.Location, maxSize: v.MaxSize}
 		case TypePersistent:
-			d = &persistentDriver{path: v.Location}
+			d = &persistentDriver{baseDir: v.Location}
+		case TypeMemory:
+			if err := checkMountPrivileges(); err != nil {
+				return nil, fmt.Errorf("memory volumes are configured, but %v", err)
+			}
+			d = &memoryDriver{baseDir: v.Location, maxSize: v.MaxSize, b: &budget{total: v.Budget}}
 		default:
 			return nil, fmt.Errorf("unsupported volume type: %s", t)
 		}
@@ -67,19 +103,89 @@ func NewManager(c Config) (*Manager, error) {
 		logrus.WithFields(logrus.Fields{
 			"driver":   t,
 			"location": v.Location,
+			"maxSize":  v.MaxSize,
+			"budget":   v.Budget,
 		}).Infof("registered volume driver")
 	}
 
+	if err := m.restore(); err != nil {
+		return nil, err
+	}
+
 	return &m, nil
 }
 
-// Purge will call delete() on every volume and remove it from the manager.
+// restore reinstates volumes recorded in the journal, compacts the journal, and garbage collects
+// data left by volumes that no longer exist.
+func (m *Manager) restore() error {
+	records, err := m.j.load()
+	if err != nil {
+		return err
+	}
+
+	var rs []record
+	inUse := make(map[string]bool)
+	for id, r := range records {
+		log := logrus.WithFields(logrus.Fields{
+			"volumeID":   id,
+			"volumeType": r.Type,
+		})
+
+		d, ok := m.support[r.Type]
+		if !ok {
+			log.Warn("discarding volume of unsupported type")
+			continue
+		}
+
+		h := d.new()
+		if err := h.restore(r.Handle, r.Options); err != nil {
+			log.WithError(err).Warn("failed to restore volume")
+			continue
+		}
+		m.volumes[id] = h
+		inUse[h.handle()] = true
+		rs = append(rs, r)
+		log.Info("restored volume")
+	}
+
+	// Compact the journal, so that it only contains volumes that exist.
+	if err := m.j.rewrite(rs); err != nil {
+		return err
+	}
+
+	for t, d := range m.support {
+		if err := d.gc(inUse); err != nil {
+			logrus.WithError(err).WithField("driver", t).Warn("failed to remove orphaned volumes")
+		}
+	}
+	return nil
+}
+
+// Types returns the volume types supported by the manager.
+func (m *Manager) Types() []string {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	types := make([]string, 0, len(m.support))
+	for t := range m.support {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Purge will call delete() on every volume that is not retained across agent restarts, and remove
+// it from the manager. Retained volumes are left intact, to be restored when the agent restarts.
 // Any errors will be logged with logrus.
 func (m *Manager) Purge() {
 	m.m.Lock()
 	defer m.m.Unlock()
 
 	for id, vol := range m.volumes {
+		if vol.durable() {
+			continue
+		}
+
 		log := logrus.WithFields(logrus.Fields{
 			"volumeID": id,
 		})
@@ -88,6 +194,10 @@ func (m *Manager) Purge() {
 		err := vol.delete()
 		if err != nil {
 			log.WithError(err).Warn("failed to delete volume")
+			continue
+		}
+		if err := m.forget(id); err != nil {
+			log.WithError(err).Warn("failed to journal volume deletion")
 		}
 		log.Infof("volume deleted")
 	}
@@ -96,13 +206,31 @@ func (m *Manager) Purge() {
 
 // Create adds a volume to the manager and preforms any required
 // setup based on the volume type.
-func (m *Manager) Create(id, t string) error {
+func (m *Manager) Create(id, t string, o Options) error {
 	h, err := m.create(id, t)
 	if err != nil {
 		return err
 	}
 
-	return h.create(id)
+	if err := h.create(id, o); err != nil {
+		m.m.Lock()
+		delete(m.volumes, id)
+		m.m.Unlock()
+		return err
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	// A volume that is not journaled would not be restored, so roll back the volume.
+	if err := m.j.append(record{Op: opCreate, ID: id, Type: t, Options: o, Handle: h.handle()}); err != nil {
+		if derr := h.delete(); derr != nil {
+			logrus.WithError(derr).WithField("volumeID", id).Warn("failed to delete volume")
+		}
+		delete(m.volumes, id)
+		return err
+	}
+	return nil
 }
 
 // create registers a volume handler with the manager in a thread safe manner.
@@ -132,7 +260,19 @@ func (m *Manager) Delete(id string) error {
 		return err
 	}
 
-	return h.delete()
+	if err := h.delete(); err != nil {
+		return err
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+	return m.forget(id)
+}
+
+// forget journals the deletion of a volume. The caller must hold m.m.
+func (m *Manager) forget(id string) error {
+	delete(m.volumes, id)
+	return m.j.append(record{Op: opDelete, ID: id})
 }
 
 // remove deletes a volume handler from the manager in a thread safe manner.
@@ -170,3 +310,24 @@ func (m *Manager) getHandler(id string) (handler, error) {
 
 	return h, nil
 }
+
+// Usage returns the space used by the volume.
+func (m *Manager) Usage(id string) (Usage, error) {
+	h, err := m.getHandler(id)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	return h.usage()
+}
+
+// Full returns true if the volume is size limited, and has reached its limit.
+func (m *Manager) Full(id string) bool {
+	h, err := m.getHandler(id)
+	if err != nil || !h.limited() {
+		return false
+	}
+
+	u, err := h.usage()
+	return err == nil && u.Full()
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManagerRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-manager-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ephemeralDir := filepath.Join(dir, "ephemeral")
+	persistentDir := filepath.Join(dir, "persistent")
+	for _, d := range []string{ephemeralDir, persistentDir} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := Config{
+		"ephemeral":  {Location: ephemeralDir},
+		"persistent": {Location: persistentDir},
+	}
+	statePath := filepath.Join(dir, "state", "volumes")
+
+	m, err := NewManager(c, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create volumes, deleting one of them.
+	if err := m.Create("kept", TypeEphemeral, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Create("deleted", TypeEphemeral, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Create("shared", TypePersistent, Options{Name: "data"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delete("deleted"); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := m.GetHandle("kept")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave behind an orphaned ephemeral volume, and an unrelated directory.
+	orphan, err := ioutil.TempDir(ephemeralDir, ephemeralPrefix+"orphan-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrelated := filepath.Join(ephemeralDir, "unrelated")
+	if err := os.Mkdir(unrelated, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a restart.
+	m, err = NewManager(c, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		wantHandle string
+		wantErr    bool
+	}{
+		{"Ephemeral", "kept", kept, false},
+		{"Persistent", "shared", filepath.Join(persistentDir, "data"), false},
+		{"Deleted", "deleted", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := m.GetHandle(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if h != tt.wantHandle {
+				t.Errorf("got handle %v, want %v", h, tt.wantHandle)
+			}
+		})
+	}
+
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("orphaned volume not removed")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("unrelated directory removed: %v", err)
+	}
+
+	// Deleting a restored volume should remove it from the journal.
+	if err := m.Delete("kept"); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = NewManager(c, statePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetHandle("kept"); err == nil {
+		t.Errorf("deleted volume restored")
+	}
+}
+
+func TestManagerPurgeRetainsDurableVolumes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-manager-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ephemeralDir := filepath.Join(dir, "ephemeral")
+	persistentDir := filepath.Join(dir, "persistent")
+	for _, d := range []string{ephemeralDir, persistentDir} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := Config{
+		"ephemeral":  {Location: ephemeralDir},
+		"persistent": {Location: persistentDir},
+	}
+	statePath := filepath.Join(dir, "state", "volumes")
+
+	m, err := NewManager(c, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Create("scratch", TypeEphemeral, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Create("shared", TypePersistent, Options{Name: "data"}); err != nil {
+		t.Fatal(err)
+	}
+	scratch, err := m.GetHandle("scratch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a graceful stop, followed by a restart.
+	m.Purge()
+	if m, err = NewManager(c, statePath); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string]string{
+		"scratch": scratch,
+		"shared":  filepath.Join(persistentDir, "data"),
+	} {
+		got, err := m.GetHandle(id)
+		if err != nil {
+			t.Errorf("volume %v not restored: %v", id, err)
+		} else if got != want {
+			t.Errorf("volume %v: got handle %v, want %v", id, got, want)
+		}
+	}
+	if _, err := os.Stat(scratch); err != nil {
+		t.Errorf("ephemeral volume data removed: %v", err)
+	}
+}
+
+func TestManagerCreateJournalError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-manager-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ephemeralDir := filepath.Join(dir, "ephemeral")
+	if err := os.Mkdir(ephemeralDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(dir, "volumes")
+
+	m, err := NewManager(Config{"ephemeral": {Location: ephemeralDir}}, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the journal with a directory, so that appending to it fails.
+	if err := os.RemoveAll(statePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(statePath, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Create("id", TypeEphemeral, Options{}); err == nil {
+		t.Fatalf("got nil error")
+	}
+
+	// The volume should be rolled back.
+	if _, err := m.GetHandle("id"); err == nil {
+		t.Errorf("volume remains in manager")
+	}
+	fis, err := ioutil.ReadDir(ephemeralDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 0 {
+		t.Errorf("got %v entries in volume directory, want 0", len(fis))
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package volume
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// budget tracks the memory reserved by memory volumes.
+type budget struct {
+	m     sync.Mutex
+	total int64 // Total memory available to volumes, or zero if unlimited.
+	used  int64
+}
+
+// reserve reserves size bytes, returning an error if this would exceed the budget. If force is
+// true, the reservation is made regardless of the budget.
+func (b *budget) reserve(size int64, force bool) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if !force && b.total > 0 && b.used+size > b.total {
+		return fmt.Errorf("memory volume of %d bytes exceeds budget (%d of %d bytes in use)", size, b.used, b.total)
+	}
+	b.used += size
+	return nil
+}
+
+// release releases size bytes previously reserved.
+func (b *budget) release(size int64) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.used -= size
+}
+
+type memoryDriver struct {
+	baseDir string
+	maxSize int64
+	b       *budget
+}
+
+func (md memoryDriver) new() handler {
+	return &memory{baseDir: md.baseDir, maxSize: md.maxSize, b: md.b}
+}
+
+// gc unmounts and removes memory volume directories within the base directory that are not in
+// use.
+func (md memoryDriver) gc(inUse map[string]bool) error {
+	return removeOrphans(md.baseDir, inUse)
+}
+
+// memory represents a short lived volume that is backed by a size limited tmpfs, and does not
+// retain data.
+type memory struct {
+	baseDir string
+	maxSize int64
+	b       *budget
+	path    string
+	size    int64
+}
+
+func (m *memory) create(id string, o Options) error {
+	size := limit(o.Size, m.maxSize)
+	if size <= 0 {
+		return fmt.Errorf("memory volume size not specified")
+	}
+	if err := m.b.reserve(size, false); err != nil {
+		return err
+	}
+
+	path, err := ioutil.TempDir(m.baseDir, ephemeralPrefix+id+"-")
+	if err != nil {
+		m.b.release(size)
+		return err
+	}
+	if err := mountTmpfs(path, size); err != nil {
+		os.RemoveAll(path)
+		m.b.release(size)
+		return err
+	}
+
+	m.path = path
+	m.size = size
+	return nil
+}
+
+func (m *memory) restore(handle string, o Options) error {
+	size := limit(o.Size, m.maxSize)
+	if size <= 0 {
+		return fmt.Errorf("memory volume size not specified")
+	}
+
+	// Contents do not survive a node restart, in which case an empty tmpfs is mounted.
+	if !isMountPoint(handle) {
+		if err := mountTmpfs(handle, size); err != nil {
+			return err
+		}
+	}
+
+	// The volume exists, so it is accounted for even if the budget has since been reduced.
+	if err := m.b.reserve(size, true); err != nil {
+		return err
+	}
+
+	m.path = handle
+	m.size = size
+	return nil
+}
+
+func (m memory) delete() error {
+	if err := unmount(m.path); err != nil {
+		return err
+	}
+	m.b.release(m.size)
+
+	return os.RemoveAll(m.path)
+}
+
+func (m memory) handle() string {
+	return m.path
+}
+
+func (m memory) usage() (Usage, error) {
+	return fsUsage(m.path)
+}
+
+func (memory) limited() bool {
+	return true
+}
+
+// durable returns false, so that the memory held by the volume is released when the agent stops.
+func (memory) durable() bool {
+	return false
+}
+
+// mountTmpfs mounts a tmpfs of the supplied size on dir.
+func mountTmpfs(dir string, size int64) error {
+	opts := "size=" + strconv.FormatInt(size, 10) + ",mode=0700"
+	if err := run("mount", "-t", "tmpfs", "-o", opts, "tmpfs", dir); err != nil {
+		return fmt.Errorf("failed to mount memory volume: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestBudget(t *testing.T) {
+	b := budget{total: 1024}
+
+	if err := b.reserve(1024, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.reserve(1, false); err == nil {
+		t.Fatalf("reserved beyond budget")
+	}
+	if err := b.reserve(1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	b.release(1)
+	b.release(512)
+	if err := b.reserve(512, false); err != nil {
+		t.Fatal(err)
+	}
+	if b.used != 1024 {
+		t.Errorf("got %v used, want %v", b.used, 1024)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("mounting memory volumes requires root")
+	}
+	for _, cmd := range []string{"mount", "umount", "mountpoint"} {
+		if _, err := exec.LookPath(cmd); err != nil {
+			t.Skipf("%v not found", cmd)
+		}
+	}
+
+	baseDir, err := ioutil.TempDir("", "test-memory-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	const size = 1024 * 1024
+	b := &budget{total: size}
+	m := memory{baseDir: baseDir, b: b}
+
+	// Size must be specified, as there is no maximum.
+	if err := m.create("TestID", Options{}); err == nil {
+		t.Fatalf("created memory volume without size")
+	}
+
+	if err := m.create("TestID", Options{Size: size}); err != nil {
+		t.Skipf("failed to create memory volume: %v", err)
+	}
+	defer m.delete()
+
+	// The budget is exhausted.
+	other := memory{baseDir: baseDir, b: b}
+	if err := other.create("OtherID", Options{Size: 1}); err == nil {
+		other.delete()
+		t.Fatalf("created memory volume beyond budget")
+	}
+
+	// write to a test file in the volume
+	testPath := filepath.Join(m.handle(), "test-file")
+	if err := ioutil.WriteFile(testPath, []byte("testfile"), 0644); err != nil {
+		t.Fatalf("failed to write to test file in volume")
+	}
+
+	u, err := m.usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Limit != size {
+		t.Errorf("got limit %v, want %v", u.Limit, size)
+	}
+
+	if err := m.delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(m.handle()); !os.IsNotExist(err) {
+		t.Fatalf("failed to remove memory volume location")
+	}
+	if b.used != 0 {
+		t.Errorf("got %v used, want 0", b.used)
+	}
+}
@@ -2,22 +2,65 @@
 
 package volume
 
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
 type persistentDriver struct {
-	path string
+	baseDir string
 }
 
 func (pd persistentDriver) new() handler {
-	return &persistent{path: pd.path}
+	return &persistent{baseDir: pd.baseDir}
+}
+
+// gc does nothing, as persistent volumes retain data after they are deleted.
+func (pd persistentDriver) gc(inUse map[string]bool) error {
+	return nil
 }
 
+// persistent represents a volume that retains data across workflows. Each volume is a
+// subdirectory of the base directory, keyed by volume name, or by volume ID if it has no name.
 type persistent struct {
-	path string
+	baseDir string
+	path    string
 }
 
-func (persistent) create(id string) error {
+// validateName ensures name is safe to use as a path component, and within a bind path.
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\,:`) {
+		return fmt.Errorf("invalid volume name %q", name)
+	}
+	return nil
+}
+
+func (p *persistent) create(id string, o Options) error {
+	key := o.Name
+	if key == "" {
+		key = id
+	}
+	if err := validateName(key); err != nil {
+		return err
+	}
+
+	// Create the directory on first use.
+	path := filepath.Join(p.baseDir, key)
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return err
+	}
+	p.path = path
 	return nil
 }
 
+// restore reinstates the volume from its key, so that it follows any change in base directory.
+// Volumes without a name are keyed by ID, which is the last element of handle.
+func (p *persistent) restore(handle string, o Options) error {
+	return p.create(filepath.Base(handle), o)
+}
+
 func (persistent) delete() error {
 	return nil
 }
@@ -25,3 +68,15 @@ func (persistent) delete() error {
 func (p persistent) handle() string {
 	return p.path
 }
+
+func (p persistent) usage() (Usage, error) {
+	return dirUsage(p.path)
+}
+
+func (persistent) limited() bool {
+	return false
+}
+
+func (persistent) durable() bool {
+	return true
+}
@@ -12,35 +12,59 @@ import (
 
 func TestPersistent(t *testing.T) {
 	testID := "TestID"
+	testName := "TestName"
 	testContent := []byte("testfile")
 	testFilename := "test-file"
 
 	// create tmpdir as base for volume
-	path, err := ioutil.TempDir("", "test-persistent-")
+	baseDir, err := ioutil.TempDir("", "test-persistent-")
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.RemoveAll(path)
-	testPath := filepath.Join(path, testFilename)
+	defer os.RemoveAll(baseDir)
+
+	p := persistent{
+		baseDir: baseDir,
+	}
+
+	// volume directory is created on first use
+	err = p.create(testID, Options{Name: testName})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handlePath := p.handle()
+	if want := filepath.Join(baseDir, testName); handlePath != want {
+		t.Fatalf("want %s, got %s", want, handlePath)
+	}
 
 	// write to a test file in the volume
+	testPath := filepath.Join(handlePath, testFilename)
 	if err := ioutil.WriteFile(testPath, testContent, 0644); err != nil {
 		t.Fatalf("failed to write to test file in volume")
 	}
 
-	p := persistent{
-		path: path,
+	err = p.delete()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// NOTE: testID is ignored by the persistent file handler
-	err = p.create(testID)
+	// ensure test file remains after volume deletion
+	content, err := ioutil.ReadFile(testPath)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// ensure test file appears in volume
-	handlePath := p.handle()
-	content, err := ioutil.ReadFile(filepath.Join(handlePath, testFilename))
+	if bytes.Compare(content, testContent) != 0 {
+		t.Fatalf("want %s, got %s", string(testContent), string(content))
+	}
+
+	// ensure test file appears in a new volume with the same name, but not a different one
+	p2 := persistent{baseDir: baseDir}
+	if err := p2.create("OtherID", Options{Name: testName}); err != nil {
+		t.Fatal(err)
+	}
+	content, err = ioutil.ReadFile(filepath.Join(p2.handle(), testFilename))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -49,18 +73,69 @@ func TestPersistent(t *testing.T) {
 		t.Fatalf("want %s, got %s", string(testContent), string(content))
 	}
 
-	err = p.delete()
+	p3 := persistent{baseDir: baseDir}
+	if err := p3.create("OtherID", Options{Name: "OtherName"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(p3.handle(), testFilename)); !os.IsNotExist(err) {
+		t.Fatalf("test file visible in volume with different name")
+	}
+}
+
+func TestPersistentInvalidName(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test-persistent-")
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer os.RemoveAll(baseDir)
 
-	// ensure test file remains after volume deletion
-	content, err = ioutil.ReadFile(testPath)
+	tests := []struct {
+		name string
+	}{
+		{"."},
+		{".."},
+		{"../escape"},
+		{"a/b"},
+		{"a,b"},
+		{"a:b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := persistent{baseDir: baseDir}
+			if err := p.create("TestID", Options{Name: tt.name}); err == nil {
+				t.Fatalf("expected error for name %q", tt.name)
+			}
+		})
+	}
+}
+
+func TestPersistentNoName(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test-persistent-")
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer os.RemoveAll(baseDir)
 
-	if bytes.Compare(content, testContent) != 0 {
-		t.Fatalf("want %s, got %s", string(testContent), string(content))
+	// Volumes without a name are keyed by ID.
+	p := persistent{baseDir: baseDir}
+	if err := p.create("TestID", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.handle(), filepath.Join(baseDir, "TestID"); got != want {
+		t.Errorf("got handle %v, want %v", got, want)
+	}
+
+	// Restoring should resolve the same directory.
+	r := persistent{baseDir: baseDir}
+	if err := r.restore(p.handle(), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.handle(), p.handle(); got != want {
+		t.Errorf("got restored handle %v, want %v", got, want)
+	}
+
+	// IDs that are not safe to use as a path component are rejected.
+	if err := p.create("../TestID", Options{}); err == nil {
+		t.Errorf("got nil error")
 	}
 }
@@ -0,0 +1,40 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+package volume
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Usage describes the space used by a volume.
+type Usage struct {
+	Used  int64 // Bytes used.
+	Limit int64 // Capacity of the volume in bytes, or zero if unlimited.
+}
+
+// fullFraction is the fraction of the capacity of a volume below which free space is considered
+// exhausted. Filesystems rarely allocate every last block, so a volume that has reached its limit
+// usually has a small amount of space remaining.
+const fullFraction = 100
+
+// Full returns true if the volume has reached its size limit.
+func (u Usage) Full() bool {
+	return u.Limit > 0 && u.Limit-u.Used < u.Limit/fullFraction
+}
+
+// dirUsage returns the usage of the directory at path, which is the total size of the regular
+// files it contains.
+func dirUsage(path string) (Usage, error) {
+	var u Usage
+	err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			u.Used += fi.Size()
+		}
+		return nil
+	})
+	return u, err
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+// +build !linux,!darwin
+
+package volume
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// fsUsage returns the usage of the filesystem containing path.
+func fsUsage(path string) (Usage, error) {
+	return Usage{}, fmt.Errorf("filesystem usage not supported on %v", runtime.GOOS)
+}
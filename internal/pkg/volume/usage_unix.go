@@ -0,0 +1,21 @@
+// Copyright (c) 2020, Sylabs, Inc. All rights reserved.
+
+// +build linux darwin
+
+package volume
+
+import "syscall"
+
+// fsUsage returns the usage of the filesystem containing path. Blocks that are not available to
+// unprivileged users are considered to be used.
+func fsUsage(path string) (Usage, error) {
+	var s syscall.Statfs_t
+	if err := syscall.Statfs(path, &s); err != nil {
+		return Usage{}, err
+	}
+	bsize := int64(s.Bsize)
+	return Usage{
+		Used:  int64(s.Blocks-uint64(s.Bavail)) * bsize,
+		Limit: int64(s.Blocks) * bsize,
+	}, nil
+}